@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -28,9 +29,12 @@ const defaultBenchArgsTmpl = `test {{ .Packages }} -run '^$'
 var benchstatVars = kong.Vars{
 	"AlphaDefault":        "0.05",
 	"AlphaHelp":           `consider change significant if p < α`,
-	"DeltaTestHelp":       `significance test to apply to delta: utest, ttest, or none`,
+	"ConfidenceLevelHelp": `show bootstrap confidence intervals for the change in the median at this level, like 0.95. 0 disables`,
+	"CorrectionHelp":      `correct p-values for comparing many benchmarks: bonferroni, holm, bh (Benjamini-Hochberg) or none`,
+	"CorrectionEnum":      `bonferroni,holm,bh,none`,
+	"DeltaTestHelp":       `significance test to apply to delta: utest, ttest, permutation, or none`,
 	"DeltaTestDefault":    `utest`,
-	"DeltaTestEnum":       `utest,ttest,none`,
+	"DeltaTestEnum":       `utest,ttest,permutation,none`,
 	"GeomeanHelp":         `print the geometric mean of each file`,
 	"NorangeHelp":         `suppress range columns (CSV and markdown only)`,
 	"ReverseSortHelp":     `reverse sort order`,
@@ -45,7 +49,9 @@ var benchstatVars = kong.Vars{
 type benchstatOpts struct {
 	Alpha           float64 `kong:"default=${AlphaDefault},help=${AlphaHelp},group=benchstat"`
 	BenchstatOutput string  `kong:"default=text,enum=${BenchstatOutputEnum},help=${BenchstatOutputHelp},group=benchstat"`
-	DeltaTest       string  `kong:"help=${DeltaTestHelp},default=${DeltaTestDefault},enum='utest,ttest,none',group=benchstat"`
+	ConfidenceLevel float64 `kong:"placeholder=LEVEL,help=${ConfidenceLevelHelp},group=benchstat"`
+	Correction      string  `kong:"default=none,enum=${CorrectionEnum},help=${CorrectionHelp},group=benchstat"`
+	DeltaTest       string  `kong:"help=${DeltaTestHelp},default=${DeltaTestDefault},enum=${DeltaTestEnum},group=benchstat"`
 	Geomean         bool    `kong:"help=${GeomeanHelp},group=benchstat"`
 	Norange         bool    `kong:"help=${NorangeHelp},group=benchstat"`
 	ReverseSort     bool    `kong:"help=${ReverseSortHelp},group=benchstat"`
@@ -56,31 +62,62 @@ type benchstatOpts struct {
 var version string
 
 var benchVars = kong.Vars{
-	"version":              version,
-	"BenchCmdDefault":      `go`,
-	"CountHelp":            `Run each benchmark n times. If --cpu is set, run n times for each GOMAXPROCS value.'`,
-	"BenchHelp":            `Run only those benchmarks matching a regular expression. To run all benchmarks, use '--bench .'.`,
-	"BenchmarkArgsHelp":    `Override the default args to the go command. This may be a template. See https://github.com/willabides/benchdiff for details."`,
-	"BenchtimeHelp":        `Run enough iterations of each benchmark to take t, specified as a time.Duration (for example, --benchtime 1h30s). The default is 1 second (1s). The special syntax Nx means to run the benchmark N times (for example, -benchtime 100x).`,
-	"PackagesHelp":         `Run benchmarks in these packages.`,
-	"BenchCmdHelp":         `The command to use for benchmarks.`,
-	"CacheDirHelp":         `Override the default directory where benchmark output is kept.`,
-	"BaseRefHelp":          `The git ref to be used as a baseline.`,
-	"CooldownHelp":         `How long to pause for cooldown between head and base runs.`,
-	"ForceBaseHelp":        `Rerun benchmarks on the base reference even if the output already exists.`,
-	"OnDegradeHelp":        `Exit code when there is a statistically significant degradation in the results.`,
-	"JSONHelp":             `Format output as JSON.`,
-	"GitCmdHelp":           `The executable to use for git commands.`,
-	"ToleranceHelp":        `The minimum percent change before a result is considered degraded.`,
-	"VersionHelp":          `Output the benchdiff version and exit.`,
-	"ShowCacheDirHelp":     `Output the cache dir and exit.`,
-	"ClearCacheHelp":       `Remove benchdiff files from the cache dir.`,
-	"ShowBenchCmdlineHelp": `Instead of running benchmarks, output the command that would be used and exit.`,
-	"CPUHelp":              `Specify a list of GOMAXPROCS values for which the benchmarks should be executed. The default is the current value of GOMAXPROCS.`,
-	"BenchmemHelp":         `Memory allocation statistics for benchmarks.`,
-	"WarmupCountHelp":      `Run benchmarks with -count=n as a warmup`,
-	"WarmupTimeHelp":       `When warmups are run, set -benchtime=n`,
-	"TagsHelp":             `Set the -tags flag on the go test command`,
+	"version":               version,
+	"BenchCmdDefault":       `go`,
+	"CountHelp":             `Run each benchmark n times. If --cpu is set, run n times for each GOMAXPROCS value.'`,
+	"BenchHelp":             `Run only those benchmarks matching a regular expression. To run all benchmarks, use '--bench .'.`,
+	"BenchmarkArgsHelp":     `Override the default args to the go command. This may be a template. See https://github.com/willabides/benchdiff for details."`,
+	"BenchtimeHelp":         `Run enough iterations of each benchmark to take t, specified as a time.Duration (for example, --benchtime 1h30s). The default is 1 second (1s). The special syntax Nx means to run the benchmark N times (for example, -benchtime 100x).`,
+	"PackagesHelp":          `Run benchmarks in these packages.`,
+	"BenchCmdHelp":          `The command to use for benchmarks.`,
+	"CacheDirHelp":          `Override the default directory where benchmark output is kept.`,
+	"BaseRefHelp":           `The git ref to be used as a baseline.`,
+	"CooldownHelp":          `How long to pause for cooldown between head and base runs.`,
+	"ForceBaseHelp":         `Rerun benchmarks on the base reference even if the output already exists.`,
+	"OnDegradeHelp":         `Exit code when there is a statistically significant degradation in the results.`,
+	"RenameHelp":            `Rename benchmarks in the base results before comparing them. The format is 'regexp=>replacement', and the replacement may refer to capture groups like $1. The regexp is matched against the benchmark name without the GOMAXPROCS suffix. May be repeated.`,
+	"OnEmptyHelp":           `Exit code when there are no benchmark results to compare, for example because --bench matches nothing.`,
+	"OnFailureHelp":         `Exit code when benchmarks fail or panic on either side. When set, it replaces the exit code of 1 for failures without --continue-on-failure.`,
+	"OnImproveHelp":         `Exit code when there is a statistically significant improvement and nothing else sets an exit code.`,
+	"OnRemovedHelp":         `Exit code when benchmarks in the base ref are missing from HEAD. Benchmarks that look renamed count as missing.`,
+	"JSONHelp":              `Format output as JSON.`,
+	"GateHelp":              `A named policy that fails when an expression is true for any result, like 'codec-allocs=3: pkg == "example.com/codec" && metric == "allocs/op" && new > old'. The exit code defaults to 1. See https://github.com/willabides/benchdiff for the fields and functions in expressions. May be repeated.`,
+	"GeomeanToleranceHelp":  `Consider results degraded when the geometric mean of one metric across all benchmarks gets worse by more than this percent, even if no single result is significant. For example 'ns/op=3'. May be repeated.`,
+	"GitCmdHelp":            `The executable to use for git commands.`,
+	"ToleranceHelp":         `The minimum percent change before a result is considered degraded. The size of the change counts, so a 15% drop in a speed like MB/s is over a tolerance of 10.`,
+	"ToleranceRuleHelp":     `Set the tolerance for benchmarks matching a regexp, or a glob prefixed with 'glob:'. The pattern is matched against the benchmark name without the GOMAXPROCS suffix. Add '@metric' to only match one metric like 'time/op'. Use 'ignore' as the tolerance to never consider matching results degraded. The first matching rule applies. May be repeated.`,
+	"MetricToleranceHelp":   `Set the tolerance for one metric like 'allocs/op', 'B/op' or a unit from b.ReportMetric. Use 0 to fail on any significant increase or 'ignore' to never consider the metric degraded. --tolerance-rule takes precedence. May be repeated.`,
+	"MetricMinDeltaHelp":    `Only consider results in one metric degraded when the mean changes by more than this much in the metric's unit. For example 'ns/op=100' or 'allocs/op=1'. This is checked in addition to the tolerance. May be repeated.`,
+	"MetricOnDegradeHelp":   `Set the exit code for degradations in one metric. For example 'allocs/op=3'. Metrics without a code use --on-degrade. When several metrics degrade, the first non-zero code is used. May be repeated.`,
+	"VersionHelp":           `Output the benchdiff version and exit.`,
+	"ShowCacheDirHelp":      `Output the cache dir and exit.`,
+	"ClearCacheHelp":        `Remove benchdiff files from the cache dir.`,
+	"PlanHelp":              `Instead of running benchmarks, list the benchmarks matching --bench on both sides with go test -list and estimate how long the run will take, then exit.`,
+	"ShowBenchCmdlineHelp":  `Instead of running benchmarks, output the command that would be used and exit.`,
+	"CPUHelp":               `Specify a list of GOMAXPROCS values for which the benchmarks should be executed. The default is the current value of GOMAXPROCS. Only these values are removed from the end of benchmark names before matching --rename and --tolerance-rule patterns, so set it when comparing results from another machine.`,
+	"BenchmemHelp":          `Memory allocation statistics for benchmarks.`,
+	"WarmupCountHelp":       `Run benchmarks with -count=n as a warmup`,
+	"WarmupTimeHelp":        `When warmups are run, set -benchtime=n`,
+	"TagsHelp":              `Set the -tags flag on the go test command`,
+	"BuildTimeHelp":         `Instead of running benchmarks, compare the time it takes to run go build and go vet on --packages with an empty build cache. Each is run --count times.`,
+	"CommandHelp":           `Instead of running go benchmarks, run this command --count times on each ref and compare wall time, user and system cpu time and peak RSS. Arguments can be quoted like in a shell, but nothing is expanded.`,
+	"ResourceUsageHelp":     `Build each package's test binary and run it once for each --count. Compare the peak RSS, cpu time and context switches of the runs. The compiler and linker aren't measured.`,
+	"WrapperHelp":           `A command to put in front of the benchmark command on both sides. For example 'taskset -c 2'. This may be a template. See https://github.com/willabides/benchdiff for details.`,
+	"AllowPartialHelp":      `Run each package separately. Report packages that fail to load, build or run on one side instead of exiting with an error.`,
+	"ContinueOnFailureHelp": `Report benchmarks that fail or panic and compare the benchmarks that succeeded instead of exiting with an error.`,
+	"TestJSONHelp":          `Run go test with -json and rebuild benchmark results from the event stream. Other output is kept in a log file for each package in the cache dir.`,
+	"ProfileHelp":           `Use flags from this profile in .benchdiff.yaml. Flags on the command line take precedence.`,
+	"ProgressHelp":          `Write the benchmark being run, the samples completed and an estimate of the time left to stderr.`,
+	"ChangedHelp":           `Only run benchmarks in --packages that are affected by files changed since --base-ref. That is packages with changed files, packages that depend on them and packages whose tests depend on them.`,
+	"ShardHelp":             `Only run the i-th of n parts of the packages in --packages that have benchmarks at HEAD or --base-ref and save the results to --shard-file. Combine the shards with "benchdiff merge".`,
+	"ShardFileHelp":         `Where --shard saves results. The default is benchdiff-shard-i-of-n.json.`,
+	"RunHelp":               `Run benchmarks on HEAD and --base-ref and compare the results. This is the default command.`,
+	"MergeHelp":             `Combine the files saved by runs with --shard into a single report.`,
+	"MergeFilesHelp":        `Files saved by --shard. Every shard of the run must be included.`,
+	"CompareHelp":           `Compare existing benchmark results without running anything.`,
+	"CompareBaseHelp":       `File with the base benchmark results.`,
+	"CompareHeadHelp":       `File with the head benchmark results.`,
+	"CommandBuildHelp":      `A command to run once on each ref before --command. Use it to build the executable --command runs.`,
 }
 
 var groupHelp = kong.Vars{
@@ -93,26 +130,51 @@ var cli struct {
 	Version kong.VersionFlag `kong:"help=${VersionHelp}"`
 	Debug   bool             `kong:"help='write verbose output to stderr'"`
 
-	BaseRef   string        `kong:"default=HEAD,help=${BaseRefHelp},group='x'"`
-	Cooldown  time.Duration `kong:"default='100ms',help=${CooldownHelp},group='x'"`
-	ForceBase bool          `kong:"help=${ForceBaseHelp},group='x'"`
-	GitCmd    string        `kong:"default=git,help=${GitCmdHelp},group='x'"`
-	JSON      bool          `kong:"help=${JSONHelp},group='x'"`
-	OnDegrade int           `kong:"name=on-degrade,default=0,help=${OnDegradeHelp},group='x'"`
-	Tolerance float64       `kong:"default='10.0',help=${ToleranceHelp},group='x'"`
-
-	Bench            string               `kong:"default='.',help=${BenchHelp},group='gotest'"`
-	BenchmarkArgs    string               `kong:"placeholder='args',help=${BenchmarkArgsHelp},group='gotest'"`
-	BenchmarkCmd     string               `kong:"default=${BenchCmdDefault},help=${BenchCmdHelp},group='gotest'"`
-	Benchmem         bool                 `kong:"help=${BenchmemHelp},group='gotest'"`
-	Benchtime        string               `kong:"help=${BenchtimeHelp},group='gotest'"`
-	Count            int                  `kong:"default=10,help=${CountHelp},group='gotest'"`
-	CPU              CPUFlag              `kong:"help=${CPUHelp},group='gotest',placeholder='GOMAXPROCS,...'"`
-	Packages         string               `kong:"default='./...',help=${PackagesHelp},group='gotest'"`
-	ShowBenchCmdline ShowBenchCmdlineFlag `kong:"help=${ShowBenchCmdlineHelp},group='gotest'"`
-	Tags             string               `kong:"help=${TagsHelp},group='gotest'"`
-	WarmupCount      int                  `kong:"help=${WarmupCountHelp},group='gotest'"`
-	WarmupTime       string               `kong:"help=${WarmupTimeHelp},group='gotest'"`
+	BaseRef          string        `kong:"default=HEAD,help=${BaseRefHelp},group='x'"`
+	Cooldown         time.Duration `kong:"default='100ms',help=${CooldownHelp},group='x'"`
+	ForceBase        bool          `kong:"help=${ForceBaseHelp},group='x'"`
+	Gate             []string      `kong:"placeholder='name[=code]: expression',sep=none,help=${GateHelp},group='x'"`
+	GeomeanTolerance []string      `kong:"placeholder='metric=tolerance',sep=none,help=${GeomeanToleranceHelp},group='x'"`
+	GitCmd           string        `kong:"default=git,help=${GitCmdHelp},group='x'"`
+	JSON             bool          `kong:"help=${JSONHelp},group='x'"`
+	MetricMinDelta   []string      `kong:"placeholder='metric=delta',sep=none,help=${MetricMinDeltaHelp},group='x'"`
+	MetricOnDegrade  []string      `kong:"placeholder='metric=code',sep=none,help=${MetricOnDegradeHelp},group='x'"`
+	MetricTolerance  []string      `kong:"placeholder='metric=tolerance',sep=none,help=${MetricToleranceHelp},group='x'"`
+	OnDegrade        int           `kong:"name=on-degrade,default=0,help=${OnDegradeHelp},group='x'"`
+	OnEmpty          int           `kong:"name=on-empty,default=0,help=${OnEmptyHelp},group='x'"`
+	OnFailure        int           `kong:"name=on-failure,default=0,help=${OnFailureHelp},group='x'"`
+	OnImprove        int           `kong:"name=on-improve,default=0,help=${OnImproveHelp},group='x'"`
+	OnRemoved        int           `kong:"name=on-removed,default=0,help=${OnRemovedHelp},group='x'"`
+	Profile          string        `kong:"help=${ProfileHelp},group='x'"`
+	Progress         bool          `kong:"help=${ProgressHelp},group='x'"`
+	Rename           []string      `kong:"placeholder='regexp=>replacement',sep=none,help=${RenameHelp},group='x'"`
+	Tolerance        float64       `kong:"default='10.0',help=${ToleranceHelp},group='x'"`
+	ToleranceRule    []string      `kong:"placeholder='pattern[@metric]=tolerance',sep=none,help=${ToleranceRuleHelp},group='x'"`
+
+	AllowPartial      bool                 `kong:"help=${AllowPartialHelp},group='gotest'"`
+	Bench             string               `kong:"default='.',help=${BenchHelp},group='gotest'"`
+	BenchmarkArgs     string               `kong:"placeholder='args',help=${BenchmarkArgsHelp},group='gotest'"`
+	BenchmarkCmd      string               `kong:"default=${BenchCmdDefault},help=${BenchCmdHelp},group='gotest'"`
+	Benchmem          bool                 `kong:"help=${BenchmemHelp},group='gotest'"`
+	Benchtime         string               `kong:"help=${BenchtimeHelp},group='gotest'"`
+	BuildTime         bool                 `kong:"help=${BuildTimeHelp},group='gotest',xor='mode'"`
+	Changed           bool                 `kong:"help=${ChangedHelp},group='gotest'"`
+	Command           string               `kong:"placeholder='cmdline',help=${CommandHelp},group='gotest',xor='mode'"`
+	CommandBuild      string               `kong:"placeholder='cmdline',help=${CommandBuildHelp},group='gotest'"`
+	Count             int                  `kong:"default=10,help=${CountHelp},group='gotest'"`
+	ContinueOnFailure bool                 `kong:"help=${ContinueOnFailureHelp},group='gotest'"`
+	CPU               CPUFlag              `kong:"help=${CPUHelp},group='gotest',placeholder='GOMAXPROCS,...'"`
+	Packages          string               `kong:"default='./...',help=${PackagesHelp},group='gotest'"`
+	Plan              bool                 `kong:"help=${PlanHelp},group='gotest'"`
+	ResourceUsage     bool                 `kong:"name=rusage,help=${ResourceUsageHelp},group='gotest'"`
+	ShowBenchCmdline  ShowBenchCmdlineFlag `kong:"help=${ShowBenchCmdlineHelp},group='gotest'"`
+	Shard             string               `kong:"placeholder='i/n',help=${ShardHelp},group='gotest'"`
+	ShardFile         string               `kong:"placeholder='file',help=${ShardFileHelp},group='gotest'"`
+	Tags              string               `kong:"help=${TagsHelp},group='gotest'"`
+	TestJSON          bool                 `kong:"name=test-json,help=${TestJSONHelp},group='gotest'"`
+	WarmupCount       int                  `kong:"help=${WarmupCountHelp},group='gotest'"`
+	WarmupTime        string               `kong:"help=${WarmupTimeHelp},group='gotest'"`
+	Wrapper           string               `kong:"placeholder='cmdline',help=${WrapperHelp},group='gotest'"`
 
 	BenchstatOpts benchstatOpts `kong:"embed"`
 
@@ -121,6 +183,15 @@ var cli struct {
 	ShowCacheDir ShowCacheDirFlag `kong:"help=${ShowCacheDirHelp},group='cache'"`
 
 	ShowDefaultTemplate showDefaultTemplate `kong:"hidden"`
+
+	Run   struct{} `kong:"cmd,default=1,help=${RunHelp}"`
+	Merge struct {
+		Files []string `kong:"arg,type=existingfile,help=${MergeFilesHelp}"`
+	} `kong:"cmd,help=${MergeHelp}"`
+	Compare struct {
+		Base string `kong:"arg,type=existingfile,help=${CompareBaseHelp}"`
+		Head string `kong:"arg,type=existingfile,help=${CompareHeadHelp}"`
+	} `kong:"cmd,help=${CompareHelp}"`
 }
 
 // ShowCacheDirFlag flag for showing the cache directory
@@ -154,14 +225,17 @@ func (v ClearCacheFlag) AfterApply(app *kong.Kong) error {
 	if err != nil {
 		return err
 	}
-	files, err := filepath.Glob(filepath.Join(cacheDir, "benchdiff-*.out"))
-	if err != nil {
-		return fmt.Errorf("error finding files in %s: %v", cacheDir, err)
-	}
-	for _, file := range files {
-		err = os.Remove(file)
+	for _, pattern := range []string{"benchdiff-*.out", "benchdiff-*.failures.json", "benchdiff-*.logs", "benchdiff-timings.json"} {
+		var files []string
+		files, err = filepath.Glob(filepath.Join(cacheDir, pattern))
 		if err != nil {
-			return fmt.Errorf("error removing %s: %v", file, err)
+			return fmt.Errorf("error finding files in %s: %v", cacheDir, err)
+		}
+		for _, file := range files {
+			err = os.RemoveAll(file)
+			if err != nil {
+				return fmt.Errorf("error removing %s: %v", file, err)
+			}
 		}
 	}
 	app.Exit(0)
@@ -209,6 +283,13 @@ func (c CPUFlag) String() string {
 }
 
 func getBenchArgs() (string, error) {
+	return renderBenchArgs(cli.Packages)
+}
+
+// renderBenchArgs renders the benchmark args template with packages in place of cli.Packages.
+func renderBenchArgs(packages string) (string, error) {
+	data := cli
+	data.Packages = packages
 	argsTmpl := cli.BenchmarkArgs
 	if argsTmpl == "" {
 		argsTmpl = defaultBenchArgsTmpl
@@ -218,7 +299,7 @@ func getBenchArgs() (string, error) {
 		return "", err
 	}
 	var benchArgs bytes.Buffer
-	err = tmpl.Execute(&benchArgs, cli)
+	err = tmpl.Execute(&benchArgs, data)
 	if err != nil {
 		return "", err
 	}
@@ -233,6 +314,23 @@ uses benchstat to show the delta.
 More documentation at https://github.com/willabides/benchdiff.
 `
 
+// newParser returns the parser for cli with flag values from config. config is still used when
+// there is no config file so that --profile is validated.
+func newParser(config *configResolver, options ...kong.Option) (*kong.Kong, error) {
+	options = append([]kong.Option{
+		benchstatVars, benchVars, groupHelp,
+		kong.Description(strings.TrimSpace(description)),
+		kong.ExplicitGroups([]kong.Group{
+			{Key: "benchstat", Title: "benchstat options"},
+			{Key: "cache", Title: "benchmark result cache"},
+			{Key: "gotest", Title: "benchmark command line"},
+			{Key: "x"},
+		}),
+		kong.Resolvers(config),
+	}, options...)
+	return kong.New(&cli, options...)
+}
+
 func main() {
 	userCacheDir, err := os.UserCacheDir()
 	if err != nil {
@@ -241,15 +339,27 @@ func main() {
 	}
 	benchVars["CacheDirDefault"] = filepath.Join(userCacheDir, "benchdiff")
 
-	kctx := kong.Parse(&cli, benchstatVars, benchVars, groupHelp,
-		kong.Description(strings.TrimSpace(description)),
-		kong.ExplicitGroups([]kong.Group{
-			{Key: "benchstat", Title: "benchstat options"},
-			{Key: "cache", Title: "benchmark result cache"},
-			{Key: "gotest", Title: "benchmark command line"},
-			{Key: "x"},
-		}),
-	)
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "error finding working directory: %v\n", err)
+		os.Exit(1)
+	}
+	config := &configResolver{}
+	configFile := findConfigFile(wd)
+	if configFile != "" {
+		config, err = loadConfig(configFile)
+		if err != nil {
+			fmt.Fprintln(os.Stdout, err)
+			os.Exit(1)
+		}
+	}
+
+	parser, err := newParser(config)
+	if err != nil {
+		panic(err)
+	}
+	kctx, err := parser.Parse(os.Args[1:])
+	parser.FatalIfErrorf(err)
 
 	benchArgs, err := getBenchArgs()
 	kctx.FatalIfErrorf(err)
@@ -261,23 +371,140 @@ func main() {
 	kctx.FatalIfErrorf(err)
 
 	bd := &internal.Benchdiff{
-		BenchCmd:    cli.BenchmarkCmd,
-		BenchArgs:   benchArgs,
-		ResultsDir:  cacheDir,
-		BaseRef:     cli.BaseRef,
-		Path:        ".",
-		Writer:      os.Stdout,
-		Benchstat:   bStat,
-		Force:       cli.ForceBase,
-		GitCmd:      cli.GitCmd,
-		Cooldown:    cli.Cooldown,
-		WarmupTime:  cli.WarmupTime,
-		WarmupCount: cli.WarmupCount,
+		BenchCmd:          cli.BenchmarkCmd,
+		BenchArgs:         benchArgs,
+		ResultsDir:        cacheDir,
+		BaseRef:           cli.BaseRef,
+		Path:              ".",
+		Writer:            os.Stdout,
+		Benchstat:         bStat,
+		Force:             cli.ForceBase,
+		GitCmd:            cli.GitCmd,
+		Cooldown:          cli.Cooldown,
+		WarmupTime:        cli.WarmupTime,
+		WarmupCount:       cli.WarmupCount,
+		Wrapper:           cli.Wrapper,
+		ContinueOnFailure: cli.ContinueOnFailure,
+		TestJSON:          cli.TestJSON,
+		Count:             cli.Count,
+		Packages:          strings.Fields(cli.Packages),
+		Procs:             cli.CPU,
+	}
+	if cli.BuildTime {
+		bd.BuildTime = &internal.BuildTimeOptions{
+			Packages: strings.Fields(cli.Packages),
+			Tags:     cli.Tags,
+			Count:    cli.Count,
+		}
+	}
+	if cli.Command != "" {
+		bd.Command = &internal.CommandOptions{
+			Build: cli.CommandBuild,
+			Run:   cli.Command,
+			Count: cli.Count,
+		}
+	}
+	if cli.Shard != "" {
+		bd.Shard, err = internal.ParseShard(cli.Shard)
+		kctx.FatalIfErrorf(err)
+		bd.ShardFile = cli.ShardFile
+		if bd.ShardFile == "" {
+			bd.ShardFile = fmt.Sprintf("benchdiff-shard-%d-of-%d.json", bd.Shard.Index, bd.Shard.Count)
+		}
+		bd.PackageBenchArgs = renderBenchArgs
+	}
+	if cli.Changed {
+		bd.SelectChanged = true
+		bd.PackageBenchArgs = renderBenchArgs
+	}
+	if cli.ResourceUsage || cli.AllowPartial {
+		bd.ResourceUsage = cli.ResourceUsage
+		bd.AllowPartial = cli.AllowPartial
+		bd.PackageBenchArgs = renderBenchArgs
+	}
+	for _, s := range cli.Rename {
+		var rule internal.RenameRule
+		rule, err = internal.ParseRenameRule(s)
+		kctx.FatalIfErrorf(err)
+		bd.Renames = append(bd.Renames, rule)
+	}
+	var toleranceRules []internal.ToleranceRule
+	for _, s := range cli.ToleranceRule {
+		var rule internal.ToleranceRule
+		rule, err = internal.ParseToleranceRule(s)
+		kctx.FatalIfErrorf(err)
+		toleranceRules = append(toleranceRules, rule)
+	}
+	for _, s := range cli.MetricTolerance {
+		var rule internal.ToleranceRule
+		rule, err = internal.ParseMetricTolerance(s)
+		kctx.FatalIfErrorf(err)
+		toleranceRules = append(toleranceRules, rule)
+	}
+	minDeltas := map[string]float64{}
+	for _, s := range cli.MetricMinDelta {
+		var metric string
+		var delta float64
+		metric, delta, err = internal.ParseMetricMinDelta(s)
+		kctx.FatalIfErrorf(err)
+		minDeltas[metric] = delta
+	}
+	geomeanTolerances := map[string]float64{}
+	for _, s := range cli.GeomeanTolerance {
+		var metric string
+		var tolerance float64
+		metric, tolerance, err = internal.ParseGeomeanTolerance(s)
+		kctx.FatalIfErrorf(err)
+		geomeanTolerances[metric] = tolerance
+	}
+	var gates []*internal.Gate
+	for _, s := range cli.Gate {
+		var gate *internal.Gate
+		gate, err = internal.ParseGate(s)
+		kctx.FatalIfErrorf(err)
+		gates = append(gates, gate)
+	}
+	metricExitCodes := map[string]int{}
+	for _, s := range cli.MetricOnDegrade {
+		var metric string
+		var code int
+		metric, code, err = internal.ParseMetricExitCode(s)
+		kctx.FatalIfErrorf(err)
+		metricExitCodes[metric] = code
+	}
+	if cli.Progress {
+		bd.Progress = os.Stderr
 	}
 	if cli.Debug {
 		bd.Debug = log.New(os.Stderr, "", 0)
 	}
-	result, err := bd.Run()
+	if cli.Plan {
+		var plan *internal.Plan
+		plan, err = bd.Plan(&internal.PlanOptions{
+			Bench:     cli.Bench,
+			Benchtime: cli.Benchtime,
+			Tags:      cli.Tags,
+			CPU:       cli.CPU,
+		})
+		kctx.FatalIfErrorf(err)
+		err = plan.WritePlan(os.Stdout, cli.JSON)
+		kctx.FatalIfErrorf(err)
+		os.Exit(0)
+	}
+	var result *internal.RunResult
+	switch kctx.Command() {
+	case "merge <files>":
+		result, err = bd.MergeShards(cli.Merge.Files...)
+	case "compare <base> <head>":
+		result, err = bd.Compare(cli.Compare.Base, cli.Compare.Head)
+	default:
+		result, err = bd.Run()
+	}
+	var failuresErr *internal.BenchmarkFailuresError
+	if errors.As(err, &failuresErr) && cli.OnFailure != 0 {
+		kctx.Errorf("%s", err)
+		os.Exit(cli.OnFailure)
+	}
 	kctx.FatalIfErrorf(err)
 
 	outputFormat := "human"
@@ -289,17 +516,44 @@ func main() {
 		BenchstatFormatter: bStat.OutputFormatter,
 		OutputFormat:       outputFormat,
 		Tolerance:          cli.Tolerance,
+		ToleranceRules:     toleranceRules,
+		MinDeltas:          minDeltas,
+		GeomeanTolerances:  geomeanTolerances,
+		Gates:              gates,
+		Markdown:           cli.BenchstatOpts.BenchstatOutput == "markdown",
 	})
 	kctx.FatalIfErrorf(err)
-	if result.HasDegradedResult(cli.Tolerance) {
-		os.Exit(cli.OnDegrade)
+	if result.HasFailures() && cli.OnFailure != 0 {
+		os.Exit(cli.OnFailure)
+	}
+	if result.IsEmpty() && cli.OnEmpty != 0 {
+		os.Exit(cli.OnEmpty)
+	}
+	if code := internal.GateExitCode(result.CheckGates(gates)); code != 0 {
+		os.Exit(code)
+	}
+	degraded := result.DegradedRows(&internal.DegradeOptions{
+		Tolerance:         cli.Tolerance,
+		Rules:             toleranceRules,
+		MinDeltas:         minDeltas,
+		GeomeanTolerances: geomeanTolerances,
+	})
+	if code := internal.DegradeExitCode(degraded, cli.OnDegrade, metricExitCodes); code != 0 {
+		os.Exit(code)
+	}
+	if result.HasRemovedBenchmarks() && cli.OnRemoved != 0 {
+		os.Exit(cli.OnRemoved)
+	}
+	if result.HasImprovedResult() {
+		os.Exit(cli.OnImprove)
 	}
 }
 
 var deltaTestOpts = map[string]benchstat.DeltaTest{
-	"none":  benchstat.NoDeltaTest,
-	"utest": benchstat.UTest,
-	"ttest": benchstat.TTest,
+	"none":        benchstat.NoDeltaTest,
+	"utest":       benchstat.UTest,
+	"ttest":       benchstat.TTest,
+	"permutation": benchstatter.PermutationTest,
 }
 
 var sortOpts = map[string]benchstat.Order{
@@ -334,9 +588,19 @@ func buildBenchstat(opts *benchstatOpts) (*benchstatter.Benchstat, error) {
 		return nil, fmt.Errorf("unexpected output format: %s", opts.BenchstatOutput)
 	}
 
+	correction, err := benchstatter.ParseCorrection(opts.Correction)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ConfidenceLevel < 0 || opts.ConfidenceLevel >= 1 {
+		return nil, fmt.Errorf("confidence level must be between 0 and 1")
+	}
+
 	return &benchstatter.Benchstat{
 		DeltaTest:       deltaTestOpts[opts.DeltaTest],
 		Alpha:           opts.Alpha,
+		Correction:      correction,
+		ConfidenceLevel: opts.ConfidenceLevel,
 		AddGeoMean:      opts.Geomean,
 		SplitBy:         strings.Split(opts.Split, ","),
 		Order:           order,
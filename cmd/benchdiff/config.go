@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
+)
+
+const configFilename = ".benchdiff.yaml"
+
+// findConfigFile returns the path to .benchdiff.yaml in dir or the closest directory above it up
+// to the root of the git repository. It returns "" when there is none.
+func findConfigFile(dir string) string {
+	for {
+		candidate := filepath.Join(dir, configFilename)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// configResolver is a kong.Resolver for flag values from a config file. The zero value has no
+// config file. Keys are flag names
+// without the leading dashes. Values in the profile selected with --profile take precedence over
+// top-level values, and flags on the command line take precedence over both.
+type configResolver struct {
+	filename string
+	values   map[string]interface{}
+	profiles map[string]map[string]interface{}
+}
+
+func loadConfig(filename string) (*configResolver, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+	r := &configResolver{
+		filename: filename,
+		values:   map[string]interface{}{},
+		profiles: map[string]map[string]interface{}{},
+	}
+	for key, value := range raw {
+		if key != "profiles" {
+			r.values[configKey(key)] = configValue(value)
+			continue
+		}
+		profiles, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error reading %s: profiles must be a map of profile names to flags", filename)
+		}
+		for name, profileValue := range profiles {
+			profile, ok := profileValue.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("error reading %s: profile %q must be a map of flags", filename, name)
+			}
+			r.profiles[name] = map[string]interface{}{}
+			for key, value := range profile {
+				r.profiles[name][configKey(key)] = configValue(value)
+			}
+		}
+	}
+	return r, nil
+}
+
+// configKey allows snake_case keys for flag names
+func configKey(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// configValue converts value to strings that kong parses the same way as values on the command
+// line. Lists are kept as lists for flags that may be repeated. Their elements are converted by
+// flagValue once the flag is known.
+func configValue(value interface{}) interface{} {
+	if list, ok := value.([]interface{}); ok {
+		return list
+	}
+	return fmt.Sprint(value)
+}
+
+// flagValue converts the elements of list values to strings for flags that are lists of strings.
+// kong decodes lists as JSON, so other elements keep the type they have in the config file.
+func flagValue(flag *kong.Flag, value interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok || flag.Target.Kind() != reflect.Slice || flag.Target.Type().Elem().Kind() != reflect.String {
+		return value
+	}
+	values := make([]interface{}, len(list))
+	for i, v := range list {
+		values[i] = fmt.Sprint(v)
+	}
+	return values
+}
+
+// Validate implements kong.Resolver. It returns an error for keys that aren't flags.
+func (r *configResolver) Validate(app *kong.Application) error {
+	flags := map[string]bool{}
+	var addFlags func(node *kong.Node)
+	addFlags = func(node *kong.Node) {
+		for _, flag := range node.Flags {
+			flags[flag.Name] = true
+		}
+		for _, child := range node.Children {
+			addFlags(child)
+		}
+	}
+	addFlags(app.Node)
+	check := func(values map[string]interface{}, where string) error {
+		var unknown []string
+		for key := range values {
+			if !flags[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		if len(unknown) == 0 {
+			return nil
+		}
+		sort.Strings(unknown)
+		return fmt.Errorf("%s: unknown flags%s: %s", r.filename, where, strings.Join(unknown, ", "))
+	}
+	err := check(r.values, "")
+	if err != nil {
+		return err
+	}
+	for name, profile := range r.profiles {
+		err = check(profile, fmt.Sprintf(" in profile %q", name))
+		if err != nil {
+			return err
+		}
+	}
+	return r.checkProfile(app)
+}
+
+// checkProfile returns an error when the selected profile doesn't exist. kong validates resolvers
+// after flag values are set and before hooks run, so this happens before flags like
+// --show-bench-cmdline exit.
+func (r *configResolver) checkProfile(app *kong.Application) error {
+	for _, flag := range app.Flags {
+		if flag.Name != "profile" {
+			continue
+		}
+		name := flag.Target.String()
+		switch {
+		case name == "" || r.hasProfile(name):
+			return nil
+		case r.filename == "":
+			return fmt.Errorf("--profile requires a %s file", configFilename)
+		default:
+			return fmt.Errorf("%s has no profile named %q", r.filename, name)
+		}
+	}
+	return nil
+}
+
+// Resolve implements kong.Resolver
+func (r *configResolver) Resolve(kctx *kong.Context, _ *kong.Path, flag *kong.Flag) (interface{}, error) {
+	if value, ok := r.profiles[r.profile(kctx)][flag.Name]; ok {
+		return flagValue(flag, value), nil
+	}
+	return flagValue(flag, r.values[flag.Name]), nil
+}
+
+// profile returns the name of the profile selected on the command line or at the top level of the
+// config file.
+func (r *configResolver) profile(kctx *kong.Context) string {
+	for _, flag := range kctx.Flags() {
+		if flag.Name != "profile" {
+			continue
+		}
+		if name, _ := kctx.FlagValue(flag).(string); name != "" {
+			return name
+		}
+	}
+	name, _ := r.values["profile"].(string)
+	return name
+}
+
+func (r *configResolver) hasProfile(name string) bool {
+	_, ok := r.profiles[name]
+	return ok
+}
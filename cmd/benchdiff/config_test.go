@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/require"
+)
+
+// parseWithConfig parses args with flag values from a config file containing content. It returns
+// what was written to stdout and the exit code when parsing exits.
+func parseWithConfig(t *testing.T, content string, args ...string) (stdout string, exitCode int, err error) {
+	t.Helper()
+	config := &configResolver{}
+	if content != "" {
+		filename := filepath.Join(t.TempDir(), configFilename)
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+		config, err = loadConfig(filename)
+		require.NoError(t, err)
+	}
+	var out bytes.Buffer
+	exitCode = -1
+	parser, err := newParser(config,
+		kong.Writers(&out, &out),
+		kong.Exit(func(code int) { exitCode = code }),
+	)
+	require.NoError(t, err)
+	_, err = parser.Parse(args)
+	return out.String(), exitCode, err
+}
+
+func Test_findConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "repo", "sub")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "repo", ".git"), 0o700))
+	require.NoError(t, os.MkdirAll(sub, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, configFilename), nil, 0o600))
+	// doesn't look above the root of the repository
+	require.Equal(t, "", findConfigFile(sub))
+	want := filepath.Join(dir, "repo", configFilename)
+	require.NoError(t, os.WriteFile(want, nil, 0o600))
+	require.Equal(t, want, findConfigFile(sub))
+}
+
+func Test_configResolver_unknownKeys(t *testing.T) {
+	_, _, err := parseWithConfig(t, "count: 3\nbogus: 1\nalso_bogus: 2\n")
+	require.ErrorContains(t, err, "unknown flags: also-bogus, bogus")
+
+	_, _, err = parseWithConfig(t, "profiles:\n  ci:\n    bogus: 1\n")
+	require.ErrorContains(t, err, `unknown flags in profile "ci": bogus`)
+
+	filename := filepath.Join(t.TempDir(), configFilename)
+	require.NoError(t, os.WriteFile(filename, []byte("profiles: [ci]\n"), 0o600))
+	_, err = loadConfig(filename)
+	require.ErrorContains(t, err, "profiles must be a map")
+}
+
+func Test_configResolver_profiles(t *testing.T) {
+	_, _, err := parseWithConfig(t, "", "--profile", "ci")
+	require.EqualError(t, err, "--profile requires a .benchdiff.yaml file")
+
+	_, _, err = parseWithConfig(t, "count: 3\n", "--profile", "ci")
+	require.ErrorContains(t, err, `has no profile named "ci"`)
+
+	_, _, err = parseWithConfig(t, "profile: ci\nprofiles:\n  local:\n    count: 3\n")
+	require.ErrorContains(t, err, `has no profile named "ci"`)
+
+	// the profile is checked before --show-bench-cmdline exits
+	stdout, exitCode, err := parseWithConfig(t, "profiles:\n  ci:\n    count: 3\n",
+		"--profile", "nope", "--show-bench-cmdline")
+	require.ErrorContains(t, err, `has no profile named "nope"`)
+	require.Equal(t, -1, exitCode)
+	require.Empty(t, stdout)
+}
+
+func Test_configResolver_precedence(t *testing.T) {
+	content := `
+count: 3
+bench: Foo
+cpu: [1, 4]
+profiles:
+  ci:
+    count: 5
+    benchtime: 10x
+`
+	_, _, err := parseWithConfig(t, content)
+	require.NoError(t, err)
+	require.Equal(t, 3, cli.Count)
+	require.Equal(t, "Foo", cli.Bench)
+	require.Equal(t, CPUFlag{1, 4}, cli.CPU)
+	require.Equal(t, "", cli.Benchtime)
+
+	// the profile takes precedence over top-level values
+	_, _, err = parseWithConfig(t, content, "--profile", "ci")
+	require.NoError(t, err)
+	require.Equal(t, 5, cli.Count)
+	require.Equal(t, "Foo", cli.Bench)
+	require.Equal(t, "10x", cli.Benchtime)
+
+	// flags take precedence over both
+	_, _, err = parseWithConfig(t, content, "--profile", "ci", "--count", "7", "--bench", "Bar", "--cpu", "2")
+	require.NoError(t, err)
+	require.Equal(t, 7, cli.Count)
+	require.Equal(t, "Bar", cli.Bench)
+	require.Equal(t, CPUFlag{2}, cli.CPU)
+
+	// the profile can be selected in the config file
+	_, _, err = parseWithConfig(t, "profile: ci\n"+content)
+	require.NoError(t, err)
+	require.Equal(t, 5, cli.Count)
+
+	stdout, exitCode, err := parseWithConfig(t, content, "--profile", "ci", "--show-bench-cmdline")
+	require.NoError(t, err)
+	require.Equal(t, 0, exitCode)
+	require.Equal(t, "go test ./... -run '^$' -bench Foo -count 5 -benchtime 10x -cpu 1,4\n", stdout)
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// acceptTrailer is the commit message trailer that accepts degradations in matching benchmarks
+const acceptTrailer = "Benchdiff-Accept"
+
+// Accept is a Benchdiff-Accept trailer from a commit between base and head. Degraded results that
+// match it are reported as accepted instead of degraded.
+type Accept struct {
+	Pattern *regexp.Regexp `json:"-"`
+	Metric  string         `json:"metric,omitempty"` // "" matches every metric
+	Source  string         `json:"trailer"`          // the trailer value as it was written
+	Commit  string         `json:"commit"`
+	URL     string         `json:"url,omitempty"` // link to the commit. "" when the remote isn't a web host
+}
+
+func (a *Accept) matches(benchmark, metric string) bool {
+	if a.Metric != "" && a.Metric != metric {
+		return false
+	}
+	return a.Pattern.MatchString(benchmark)
+}
+
+// link returns the URL of the commit or its short sha when there is no URL
+func (a *Accept) link() string {
+	if a.URL != "" {
+		return a.URL
+	}
+	if len(a.Commit) > 12 {
+		return a.Commit[:12]
+	}
+	return a.Commit
+}
+
+// ParseAccept parses the value of a Benchdiff-Accept trailer in the form "pattern[@metric]" where
+// pattern is matched like the pattern of a ToleranceRule.
+func ParseAccept(s string) (Accept, error) {
+	pattern, metric, err := parseBenchmarkPattern(s)
+	if err != nil {
+		return Accept{}, fmt.Errorf("invalid %s trailer %q: %v", acceptTrailer, s, err)
+	}
+	return Accept{
+		Pattern: pattern,
+		Metric:  metric,
+		Source:  s,
+	}, nil
+}
+
+// readAccepts returns the Benchdiff-Accept trailers of commits in baseSHA..headSHA, newest first.
+// Results that are merged or compared don't have to come from this repository, and shallow clones
+// may not have the commits, so there are no trailers when git can't log the commits. Trailers that
+// can't be parsed are skipped.
+func (c *Benchdiff) readAccepts(baseSHA, headSHA string) ([]Accept, error) {
+	// %x1e separates commits and %x00 separates the sha and trailer values
+	format := fmt.Sprintf("%%H%%x00%%(trailers:key=%s,valueonly,separator=%%x00)%%x1e", acceptTrailer)
+	out, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "log", "--format="+format, baseSHA+".."+headSHA)
+	if err != nil {
+		c.debug().Printf("not reading %s trailers: %v", acceptTrailer, err)
+		return nil, nil
+	}
+	var commitURL string
+	remote, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "remote", "get-url", "origin")
+	if err == nil {
+		commitURL = remoteCommitURL(string(remote))
+	}
+	var accepts []Accept
+	for _, record := range strings.Split(string(out), "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x00")
+		sha := fields[0]
+		for _, value := range fields[1:] {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			accept, err := ParseAccept(value)
+			if err != nil {
+				// the commit is already in history, so failing would fail every run until it's rewritten
+				c.debug().Printf("skipping trailer in commit %s: %v", sha, err)
+				continue
+			}
+			accept.Commit = sha
+			if commitURL != "" {
+				accept.URL = commitURL + sha
+			}
+			accepts = append(accepts, accept)
+		}
+	}
+	return accepts, nil
+}
+
+var scpRemoteRegexp = regexp.MustCompile(`^[\w.-]+@([\w.-]+):(.+)$`)
+
+// remoteCommitURL returns the URL prefix for commits in a remote like "git@github.com:owner/repo.git"
+// or "https://github.com/owner/repo". It returns "" for remotes that aren't on a web host.
+func remoteCommitURL(remote string) string {
+	remote = strings.TrimSuffix(strings.TrimSpace(remote), ".git")
+	var host, repo string
+	if m := scpRemoteRegexp.FindStringSubmatch(remote); m != nil {
+		host, repo = m[1], m[2]
+	} else {
+		for _, scheme := range []string{"https://", "http://", "ssh://"} {
+			if !strings.HasPrefix(remote, scheme) {
+				continue
+			}
+			host, repo, _ = strings.Cut(strings.TrimPrefix(remote, scheme), "/")
+			if _, h, ok := strings.Cut(host, "@"); ok {
+				host = h
+			}
+			if scheme == "ssh://" {
+				// the ssh port isn't the web port
+				host, _, _ = strings.Cut(host, ":")
+			}
+		}
+	}
+	if host == "" || repo == "" {
+		return ""
+	}
+	return "https://" + host + "/" + strings.Trim(repo, "/") + "/commit/"
+}
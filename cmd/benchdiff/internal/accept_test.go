@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/perf/benchstat"
+)
+
+func TestParseAccept(t *testing.T) {
+	accept, err := ParseAccept(`BenchmarkDecode/.*`)
+	require.NoError(t, err)
+	require.Equal(t, `BenchmarkDecode/.*`, accept.Pattern.String())
+	require.Equal(t, "", accept.Metric)
+	require.Equal(t, `BenchmarkDecode/.*`, accept.Source)
+
+	accept, err = ParseAccept(`glob:BenchmarkDecode*@B/op`)
+	require.NoError(t, err)
+	require.Equal(t, `^BenchmarkDecode.*$`, accept.Pattern.String())
+	require.Equal(t, "alloc/op", accept.Metric)
+
+	_, err = ParseAccept(`BenchmarkDecode(`)
+	require.Error(t, err)
+}
+
+func Test_remoteCommitURL(t *testing.T) {
+	for remote, want := range map[string]string{
+		"git@github.com:owner/repo.git":           "https://github.com/owner/repo/commit/",
+		"https://github.com/owner/repo\n":         "https://github.com/owner/repo/commit/",
+		"https://user@gitlab.com/group/sub/repo/": "https://gitlab.com/group/sub/repo/commit/",
+		"ssh://git@git.example.com:2222/repo.git": "https://git.example.com/repo/commit/",
+		"/srv/git/repo.git":                       "",
+		"file:///srv/git/repo.git":                "",
+		"https://github.com":                      "",
+	} {
+		require.Equal(t, want, remoteCommitURL(remote), remote)
+	}
+}
+
+func TestBenchdiff_readAccepts(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	base := string(mustGit(t, dir, "rev-parse", "HEAD"))
+	mustGit(t, dir, "commit", "-am", "add validation\n\nBenchdiff-Accept: BenchmarkDecode/.*\nBenchdiff-Accept: glob:BenchmarkParse*@allocs/op\n")
+	mustGit(t, dir, "commit", "--allow-empty", "-m", "no trailers")
+	head := string(mustGit(t, dir, "rev-parse", "HEAD"))
+	accepted := string(mustGit(t, dir, "rev-parse", "HEAD~1"))
+	mustGit(t, dir, "remote", "add", "origin", "git@github.com:owner/repo.git")
+
+	differ := Benchdiff{Path: dir}
+	accepts, err := differ.readAccepts(base, head)
+	require.NoError(t, err)
+	require.Len(t, accepts, 2)
+	require.Equal(t, `BenchmarkDecode/.*`, accepts[0].Source)
+	require.Equal(t, accepted, accepts[0].Commit)
+	require.Equal(t, "https://github.com/owner/repo/commit/"+accepted, accepts[0].URL)
+	require.Equal(t, "allocs/op", accepts[1].Metric)
+
+	accepts, err = differ.readAccepts(head, head)
+	require.NoError(t, err)
+	require.Empty(t, accepts)
+
+	// a bad trailer doesn't stop the others from matching
+	mustGit(t, dir, "commit", "--allow-empty", "-m", "bad\n\nBenchdiff-Accept: (\nBenchdiff-Accept: BenchmarkEncode\n")
+	bad := string(mustGit(t, dir, "rev-parse", "HEAD"))
+	var debug bytes.Buffer
+	differ.Debug = log.New(&debug, "", 0)
+	accepts, err = differ.readAccepts(base, bad)
+	require.NoError(t, err)
+	require.Len(t, accepts, 3)
+	require.Equal(t, "BenchmarkEncode", accepts[0].Source)
+	require.Equal(t, bad, accepts[0].Commit)
+	require.Equal(t, `BenchmarkDecode/.*`, accepts[1].Source)
+	require.Contains(t, debug.String(), "skipping trailer in commit "+bad)
+
+	result := &RunResult{
+		tables: []*benchstat.Table{
+			{
+				Metric: "time/op",
+				Rows: []*benchstat.Row{
+					testRow("Decode/small-8", 20, DegradingChange),
+					testRow("Encode-8", 20, DegradingChange),
+				},
+			},
+		},
+		accepts: accepts,
+	}
+	opts := &DegradeOptions{Tolerance: 10}
+	require.Empty(t, result.DegradedRows(opts))
+	require.Len(t, result.AcceptedRows(opts), 2)
+}
+
+func TestRunResult_AcceptedRows(t *testing.T) {
+	result := &RunResult{
+		tables: []*benchstat.Table{
+			{
+				Metric: "time/op",
+				Rows: []*benchstat.Row{
+					testRow("Decode/small-8", 20, DegradingChange),
+					testRow("Encode-8", 20, DegradingChange),
+				},
+			},
+		},
+		accepts: []Accept{{
+			Pattern: regexp.MustCompile(`^BenchmarkDecode/`),
+			Source:  `^BenchmarkDecode/`,
+			Commit:  "abc",
+		}},
+	}
+	opts := &DegradeOptions{Tolerance: 10}
+	require.Equal(t, []DegradedRow{
+		testDegraded("Encode-8", "time/op", 20, 10, ""),
+	}, result.DegradedRows(opts))
+	want := testDegraded("Decode/small-8", "time/op", 20, 10, "")
+	want.Accept = &result.accepts[0]
+	require.Equal(t, []DegradedRow{want}, result.AcceptedRows(opts))
+	require.True(t, result.HasDegradedResult(10))
+
+	result.tables[0].Rows = result.tables[0].Rows[:1]
+	require.False(t, result.HasDegradedResult(10))
+}
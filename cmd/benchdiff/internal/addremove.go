@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"strings"
+
+	"golang.org/x/perf/benchstat"
+)
+
+// BenchmarkID identifies a benchmark in benchstat results
+type BenchmarkID struct {
+	Group     string `json:"group,omitempty"` // the benchstat group. For example "pkg:example.com/foo goos:linux goarch:amd64"
+	Benchmark string `json:"benchmark"`
+}
+
+func (b BenchmarkID) String() string {
+	if b.Group == "" {
+		return b.Benchmark
+	}
+	return b.Group + " " + b.Benchmark
+}
+
+// BenchmarkRename is a benchmark that appears to have been renamed between base and head
+type BenchmarkRename struct {
+	Group string `json:"group,omitempty"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+func (b BenchmarkRename) String() string {
+	s := b.Old + " -> " + b.New
+	if b.Group == "" {
+		return s
+	}
+	return b.Group + " " + s
+}
+
+// oneSidedBenchmarks returns the benchmarks in collection that only have results in the first
+// (base) or second (head) config. benchstat leaves these out of its tables.
+func oneSidedBenchmarks(collection *benchstat.Collection) (baseOnly, headOnly []BenchmarkID) {
+	if len(collection.Configs) != 2 {
+		return nil, nil
+	}
+	hasResults := func(config, group, benchmark string) bool {
+		for _, unit := range collection.Units {
+			key := benchstat.Key{Config: config, Group: group, Benchmark: benchmark, Unit: unit}
+			if collection.Metrics[key] != nil {
+				return true
+			}
+		}
+		return false
+	}
+	for _, group := range collection.Groups {
+		for _, benchmark := range collection.Benchmarks[group] {
+			inBase := hasResults(collection.Configs[0], group, benchmark)
+			inHead := hasResults(collection.Configs[1], group, benchmark)
+			id := BenchmarkID{Group: group, Benchmark: benchmark}
+			switch {
+			case inBase && !inHead:
+				baseOnly = append(baseOnly, id)
+			case inHead && !inBase:
+				headOnly = append(headOnly, id)
+			}
+		}
+	}
+	return baseOnly, headOnly
+}
+
+// detectRenames pairs up removed and added benchmarks in the same group that have the same name
+// once they are normalized by renameKey. It returns the benchmarks that are left over.
+func detectRenames(removed, added []BenchmarkID) (stillRemoved, stillAdded []BenchmarkID, renamed []BenchmarkRename) {
+	addedByKey := map[BenchmarkID][]int{}
+	for i, id := range added {
+		key := BenchmarkID{Group: id.Group, Benchmark: renameKey(id.Benchmark)}
+		addedByKey[key] = append(addedByKey[key], i)
+	}
+	matched := make([]bool, len(added))
+	for _, id := range removed {
+		key := BenchmarkID{Group: id.Group, Benchmark: renameKey(id.Benchmark)}
+		candidates := addedByKey[key]
+		// only an unambiguous match is a rename
+		if len(candidates) != 1 || matched[candidates[0]] {
+			stillRemoved = append(stillRemoved, id)
+			continue
+		}
+		matched[candidates[0]] = true
+		renamed = append(renamed, BenchmarkRename{
+			Group: id.Group,
+			Old:   id.Benchmark,
+			New:   added[candidates[0]].Benchmark,
+		})
+	}
+	for i, id := range added {
+		if !matched[i] {
+			stillAdded = append(stillAdded, id)
+		}
+	}
+	return stillRemoved, stillAdded, renamed
+}
+
+// renameKey normalizes a benchmark name so that cosmetic changes to sub-benchmark names compare
+// equal. It lowercases the name, drops "key=" prefixes from sub-benchmarks and ignores
+// punctuation, so "Parse/small" and "Parse/size=small" have the same key.
+func renameKey(name string) string {
+	parts := strings.Split(strings.ToLower(name), "/")
+	for i, part := range parts {
+		if idx := strings.Index(part, "="); idx != -1 {
+			part = part[idx+1:]
+		}
+		parts[i] = strings.Map(func(r rune) rune {
+			if r == '_' || r == '-' || r == '.' || r == ' ' {
+				return -1
+			}
+			return r
+		}, part)
+	}
+	return strings.Join(parts, "/")
+}
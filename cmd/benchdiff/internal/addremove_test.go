@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_detectRenames(t *testing.T) {
+	removed := []BenchmarkID{
+		{Group: "pkg:foo", Benchmark: "Parse/small-8"},
+		{Group: "pkg:foo", Benchmark: "Parse/large-8"},
+		{Group: "pkg:foo", Benchmark: "Decode-8"},
+		{Group: "pkg:bar", Benchmark: "Encode/json-8"},
+	}
+	added := []BenchmarkID{
+		{Group: "pkg:foo", Benchmark: "Parse/size=small-8"},
+		{Group: "pkg:foo", Benchmark: "Parse/size=large-8"},
+		{Group: "pkg:foo", Benchmark: "Unmarshal-8"},
+		{Group: "pkg:baz", Benchmark: "Encode/format=json-8"},
+	}
+	gotRemoved, gotAdded, gotRenamed := detectRenames(removed, added)
+	require.Equal(t, []BenchmarkID{
+		{Group: "pkg:foo", Benchmark: "Decode-8"},
+		{Group: "pkg:bar", Benchmark: "Encode/json-8"},
+	}, gotRemoved)
+	require.Equal(t, []BenchmarkID{
+		{Group: "pkg:foo", Benchmark: "Unmarshal-8"},
+		{Group: "pkg:baz", Benchmark: "Encode/format=json-8"},
+	}, gotAdded)
+	require.Equal(t, []BenchmarkRename{
+		{Group: "pkg:foo", Old: "Parse/small-8", New: "Parse/size=small-8"},
+		{Group: "pkg:foo", Old: "Parse/large-8", New: "Parse/size=large-8"},
+	}, gotRenamed)
+}
+
+func Test_renameKey(t *testing.T) {
+	for name, want := range map[string]string{
+		"Parse/small-8":           "parse/small8",
+		"Parse/size=small-8":      "parse/small8",
+		"Parse/Size=Small-8":      "parse/small8",
+		"Parse/size_small-8":      "parse/sizesmall8",
+		"Encode/format=json/n=10": "encode/json/10",
+	} {
+		require.Equal(t, want, renameKey(name), name)
+	}
+}
+
+func Test_detectRenames_unrelatedChange(t *testing.T) {
+	// Size/1_0 was deleted and Size/10 was added in the same change. They only look like a rename.
+	removed := []BenchmarkID{{Benchmark: "Size/1_0-8"}}
+	added := []BenchmarkID{{Benchmark: "Size/10-8"}}
+	gotRemoved, gotAdded, gotRenamed := detectRenames(removed, added)
+	require.Empty(t, gotRemoved)
+	require.Empty(t, gotAdded)
+	require.Equal(t, []BenchmarkRename{{Old: "Size/1_0-8", New: "Size/10-8"}}, gotRenamed)
+
+	result := RunResult{removed: gotRemoved, added: gotAdded, renamed: gotRenamed}
+	require.True(t, result.HasRemovedBenchmarks())
+}
@@ -8,8 +8,8 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -34,6 +34,77 @@ type Benchdiff struct {
 	WarmupCount int
 	WarmupTime  string
 	Debug       *log.Logger
+
+	// BuildTime, when set, compares how long it takes to run "go build" and "go vet" with
+	// an empty build cache instead of running benchmarks. BenchCmd is used as the go command.
+	BuildTime *BuildTimeOptions
+
+	// Command, when set, times an arbitrary command instead of running go benchmarks.
+	Command *CommandOptions
+
+	// Packages are the packages BenchArgs runs benchmarks for. It is only needed when running
+	// each package separately and for Plan.
+	Packages []string
+
+	// PackageBenchArgs returns the arguments for running benchmarks in a single package. It is
+	// required when running each package separately.
+	PackageBenchArgs func(pkg string) (string, error)
+
+	// ResourceUsage builds each package's test binary with go test -c and runs it once for each
+	// -count. The peak RSS, cpu time and context switches of each run are added as a sample of a
+	// GoTestProcess benchmark. PackageBenchArgs must return go test arguments.
+	ResourceUsage bool
+
+	// Wrapper is a template for a command to put in front of every benchmark command. The
+	// template data is a *WrapperData, and quote quotes a value as one argument. Example:
+	// "taskset -c 2 nice -n -5".
+	Wrapper string
+
+	// Runner runs every command including git and go. default: ExecRunner{}
+	Runner Runner
+
+	// AllowPartial runs each package separately. Packages that fail to load, build or run on
+	// one side are reported in the result instead of causing an error.
+	AllowPartial bool
+
+	// Renames are applied to benchmark names in the base results before they are compared.
+	Renames []RenameRule
+
+	// Procs are the GOMAXPROCS values benchmarks run with, like the values of go test's -cpu flag.
+	// Only these are removed as suffixes from benchmark names before matching Renames, tolerance
+	// rules, gates and Benchdiff-Accept trailers. default: the GOMAXPROCS of this process
+	Procs []int
+
+	// TestJSON runs go test with -json and rebuilds benchmark results from the event stream. Output
+	// that isn't a benchmark result is kept in a log file for each package next to the results.
+	TestJSON bool
+
+	// Progress, when set, receives a live display of the benchmark being run, the samples completed
+	// and an estimate of the time left based on earlier runs. How long each side takes is only
+	// recorded when it is set.
+	Progress io.Writer
+
+	// Count is how many samples of each benchmark BenchArgs runs. It is only used to display progress.
+	Count int
+
+	// SelectChanged runs only the packages in Packages that have benchmarks and are affected by
+	// files changed between BaseRef and the worktree. PackageBenchArgs is called with the
+	// space-separated list of selected packages to build the benchmark arguments.
+	SelectChanged bool
+
+	// Shard runs only part of the packages in Packages that have benchmarks so a run can be split
+	// across machines. PackageBenchArgs is called with the space-separated list of the shard's
+	// packages to build the benchmark arguments.
+	Shard *Shard
+
+	// ShardFile is where a run with Shard set saves its results for MergeShards.
+	ShardFile string
+
+	// ContinueOnFailure reports benchmarks that fail or panic in the result and compares the
+	// benchmarks that succeeded instead of returning a *BenchmarkFailuresError.
+	ContinueOnFailure bool
+
+	progress *progress // the display for the side currently running
 }
 
 type runBenchmarksResults struct {
@@ -42,6 +113,7 @@ type runBenchmarksResults struct {
 	benchmarkCmd       string
 	headSHA            string
 	baseSHA            string
+	failures           []Failure
 }
 
 func fileExists(path string) bool {
@@ -66,45 +138,99 @@ func (c *Benchdiff) gitCmd() string {
 	return c.GitCmd
 }
 
+func (c *Benchdiff) procs() []int {
+	if len(c.Procs) == 0 {
+		return []int{runtime.GOMAXPROCS(0)}
+	}
+	return c.Procs
+}
+
 func (c *Benchdiff) cacheKey() string {
 	var b []byte
 	b = append(b, []byte(c.BenchCmd)...)
 	b = append(b, []byte(c.BenchArgs)...)
+	if c.BuildTime != nil {
+		b = append(b, []byte(fmt.Sprintf("build-time %q %q %d", c.BuildTime.Packages, c.BuildTime.Tags, c.BuildTime.count()))...)
+	}
+	if c.Command != nil {
+		b = append(b, []byte(fmt.Sprintf("command %q %q %d", c.Command.Build, c.Command.Run, c.Command.count()))...)
+	}
+	if c.ResourceUsage {
+		b = append(b, []byte("resource-usage")...)
+	}
+	if c.Wrapper != "" {
+		b = append(b, []byte("wrapper "+c.Wrapper)...)
+	}
+	if c.TestJSON {
+		b = append(b, []byte("test-json")...)
+	}
 	sum := sha3.Sum224(b)
 	return base64.RawURLEncoding.EncodeToString(sum[:])
 }
 
-// runCmd runs cmd sending its stdout and stderr to debug.Write()
-func runCmd(cmd *exec.Cmd, debug *log.Logger) error {
-	if debug == nil {
-		debug = log.New(io.Discard, "", 0)
-	}
-	var bufStderr bytes.Buffer
-	stderr := io.MultiWriter(&bufStderr, debug.Writer())
-	if cmd.Stderr != nil {
-		stderr = io.MultiWriter(cmd.Stderr, stderr)
-	}
-	cmd.Stderr = stderr
-	stdout := debug.Writer()
-	if cmd.Stdout != nil {
-		stdout = io.MultiWriter(cmd.Stdout, stdout)
-	}
-	cmd.Stdout = stdout
-	debug.Printf("+ %s", cmd)
-	err := cmd.Run()
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		err = fmt.Errorf(`error running command: %s
-exit code: %d
-stderr: %s`, cmd.String(), exitErr.ExitCode(), bufStderr.String())
-	}
-	return err
+func (c *Benchdiff) benchCmdline() string {
+	if c.BuildTime != nil {
+		return c.BuildTime.cmdline(c.BenchCmd)
+	}
+	if c.Command != nil {
+		return c.Command.cmdline()
+	}
+	return fmt.Sprintf("%s %s", c.BenchCmd, c.BenchArgs)
+}
+
+// execBenchCmd runs cmd. When c.BuildTime is set it times builds using cmd's go executable instead.
+// When c.Command is set it times that command in cmd.Dir instead. Logs from go test -json are
+// written to logDir.
+func (c *Benchdiff) execBenchCmd(cmd *Command, side *WrapperData, logDir string) ([]Failure, error) {
+	if c.BuildTime != nil {
+		return nil, c.timeBuilds(cmd.Path, cmd.Dir, c.progressWriter(cmd.Stdout), side)
+	}
+	if c.Command != nil {
+		count := c.Command.count()
+		if side.warmup() {
+			count = c.WarmupCount
+		}
+		return nil, c.timeCommand(cmd.Dir, count, c.progressWriter(cmd.Stdout), side)
+	}
+	if c.perPackage() {
+		return c.runPackages(cmd, side, logDir)
+	}
+	var output bytes.Buffer
+	outputCmd := *cmd
+	outputCmd.Stdout = c.progressWriter(&output)
+	result, runErr := c.runWrapped(&outputCmd, side)
+	failures, err := c.benchOutput(output.Bytes(), cmd.Stdout, side.Side, logDir)
+	if err != nil {
+		return nil, err
+	}
+	return c.checkBenchmarkFailures(failures, result, runErr, c.ContinueOnFailure)
+}
+
+func (c *Benchdiff) warmupArgs() string {
+	warmupArgs := fmt.Sprintf("-count %d", c.WarmupCount)
+	if c.WarmupTime != "" {
+		warmupArgs = fmt.Sprintf("%s -benchtime %s", warmupArgs, c.WarmupTime)
+	}
+	return warmupArgs
 }
 
-func (c *Benchdiff) runBenchmark(ref, filename, extraArgs string, pause time.Duration, force bool) error {
-	cmd := exec.Command(c.BenchCmd, strings.Fields(c.BenchArgs+" "+extraArgs)...)
+// addBenchArgs adds the arguments benchdiff controls to the benchmark arguments in args
+func (c *Benchdiff) addBenchArgs(args string, warmup bool) string {
+	if warmup {
+		args += " " + c.warmupArgs()
+	}
+	if c.TestJSON {
+		args += " -json"
+	}
+	return args
+}
+
+func (c *Benchdiff) runBenchmark(ref, filename string, warmup bool, pause time.Duration, force bool) ([]Failure, error) {
+	args := c.addBenchArgs(c.BenchArgs, warmup)
+	cmd := NewCommand(c.BenchCmd, strings.Fields(args)...)
 
 	stdlib := false
-	if rootPath, err := runGitCmd(c.debug(), c.gitCmd(), c.Path, "rev-parse", "--show-toplevel"); err == nil {
+	if rootPath, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "rev-parse", "--show-toplevel"); err == nil {
 		// lib/time/zoneinfo.zip is a specific enough path, and it's here to
 		// stay because it's one of the few paths hardcoded into Go binaries.
 		zoneinfoPath := filepath.Join(string(rootPath), "lib", "time", "zoneinfo.zip")
@@ -120,103 +246,142 @@ func (c *Benchdiff) runBenchmark(ref, filename, extraArgs string, pause time.Dur
 		if ref != "" && !force {
 			if fileExists(filename) {
 				c.debug().Printf("+ skipping benchmark for ref %q because output file exists", ref)
-				return nil
+				return readFailuresFile(failuresFilename(filename))
 			}
 		}
 		cmd.Stdout = fileBuffer
 	}
 
+	var logDir string
+	if filename != "" && c.TestJSON {
+		logDir = testLogsDir(filename)
+		c.debug().Printf("log dir: %s", logDir)
+		err := os.RemoveAll(logDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var runErr error
+	var failures []Failure
+	side := &WrapperData{
+		Side: SideHead,
+		Ref:  ref,
+	}
+	if ref != "" {
+		side.Side = SideBase
+	}
+	if warmup {
+		side.Side = SideWarmup
+	}
+
 	if ref == "" {
-		runErr = runCmd(cmd, c.debug())
+		side.Worktree, runErr = filepath.Abs(c.Path)
+		if runErr != nil {
+			return nil, runErr
+		}
+		failures, runErr = c.execSide(cmd, side, logDir)
 	} else {
-		err := runAtGitRef(c.debug(), c.gitCmd(), c.Path, c.BaseRef, func(workPath string) {
+		err := runAtGitRef(c.runner(), c.debug(), c.gitCmd(), c.Path, c.BaseRef, func(workPath string) {
 			if pause > 0 {
 				time.Sleep(pause)
 			}
 			if stdlib {
-				makeCmd := exec.Command(filepath.Join(workPath, "src", "make.bash"))
+				makeCmd := NewCommand(filepath.Join(workPath, "src", "make.bash"))
 				makeCmd.Dir = filepath.Join(workPath, "src")
 				makeCmd.Env = append(os.Environ(), "GOOS=", "GOARCH=")
-				runErr = runCmd(makeCmd, c.debug())
+				_, runErr = runCmd(c.runner(), makeCmd, c.debug())
 				if runErr != nil {
 					return
 				}
 				cmd.Path = filepath.Join(workPath, "bin", "go")
 			}
 			cmd.Dir = workPath // TODO: add relative path of working directory
-			runErr = runCmd(cmd, c.debug())
+			side.Worktree = workPath
+			failures, runErr = c.execSide(cmd, side, logDir)
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	if runErr != nil {
-		return runErr
+		return nil, runErr
 	}
 	if filename == "" {
-		return nil
+		return failures, nil
 	}
-	return os.WriteFile(filename, fileBuffer.Bytes(), 0o666)
+	err := os.WriteFile(filename, fileBuffer.Bytes(), 0o666)
+	if err != nil {
+		return nil, err
+	}
+	return failures, writeFailuresFile(failuresFilename(filename), failures)
+}
+
+// baseOutputFilename returns the file where results for baseSHA are cached
+func (c *Benchdiff) baseOutputFilename(baseSHA string) string {
+	return filepath.Join(c.ResultsDir, fmt.Sprintf("benchdiff-%s-%s.out", baseSHA, c.cacheKey()))
 }
 
 func (c *Benchdiff) runBenchmarks() (result *runBenchmarksResults, err error) {
-	headSHA, err := runGitCmd(c.debug(), c.gitCmd(), c.Path, "rev-parse", "HEAD")
+	headSHA, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "rev-parse", "HEAD")
 	if err != nil {
 		return nil, err
 	}
 
-	baseSHA, err := runGitCmd(c.debug(), c.gitCmd(), c.Path, "rev-parse", c.BaseRef)
+	baseSHA, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "rev-parse", c.BaseRef)
 	if err != nil {
 		return nil, err
 	}
 
-	baseFilename := fmt.Sprintf("benchdiff-%s-%s.out", baseSHA, c.cacheKey())
-	baseFilename = filepath.Join(c.ResultsDir, baseFilename)
+	baseFilename := c.baseOutputFilename(string(baseSHA))
 
 	worktreeFilename := filepath.Join(c.ResultsDir, "benchdiff-worktree.out")
 
 	result = &runBenchmarksResults{
-		benchmarkCmd:       fmt.Sprintf("%s %s", c.BenchCmd, c.BenchArgs),
+		benchmarkCmd:       c.benchCmdline(),
 		headSHA:            strings.TrimSpace(string(headSHA)),
 		baseSHA:            strings.TrimSpace(string(baseSHA)),
 		baseOutputFile:     baseFilename,
 		worktreeOutputFile: worktreeFilename,
 	}
 
-	doWarmup := c.WarmupCount > 0
-
-	warmupArgs := fmt.Sprintf("-count %d", c.WarmupCount)
-	if c.WarmupTime != "" {
-		warmupArgs = fmt.Sprintf("%s -benchtime %s", warmupArgs, c.WarmupTime)
-	}
+	// Every build starts with an empty cache, so there is nothing to warm up in build time mode.
+	doWarmup := c.WarmupCount > 0 && c.BuildTime == nil
 
 	var cooldown time.Duration
 
 	if doWarmup {
-		err = c.runBenchmark(c.BaseRef, "", warmupArgs, cooldown, c.Force)
+		_, err = c.runBenchmark(c.BaseRef, "", true, cooldown, c.Force)
 		if err != nil {
 			return nil, err
 		}
 		cooldown = c.Cooldown
 	}
 
-	err = c.runBenchmark(c.BaseRef, baseFilename, "", cooldown, c.Force)
+	baseFailures, err := c.runBenchmark(c.BaseRef, baseFilename, false, cooldown, c.Force)
 	if err != nil {
 		return nil, err
 	}
 	cooldown = c.Cooldown
 
-	err = c.runBenchmark("", worktreeFilename, "", cooldown, false)
+	headFailures, err := c.runBenchmark("", worktreeFilename, false, cooldown, false)
 	if err != nil {
 		return nil, err
 	}
+	result.failures = append(result.failures, baseFailures...)
+	result.failures = append(result.failures, headFailures...)
 
 	return result, nil
 }
 
 // Run runs the Benchdiff
 func (c *Benchdiff) Run() (*RunResult, error) {
+	if c.SelectChanged {
+		return c.runChanged()
+	}
+	if c.Shard != nil {
+		return c.runShard()
+	}
 	err := os.MkdirAll(c.ResultsDir, 0o700)
 	if err != nil {
 		return nil, err
@@ -225,25 +390,101 @@ func (c *Benchdiff) Run() (*RunResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	collection, err := c.Benchstat.Run(res.baseOutputFile, res.worktreeOutputFile)
+	return c.compare(res)
+}
+
+// Compare compares existing benchmark results in baseFile and headFile without running anything
+func (c *Benchdiff) Compare(baseFile, headFile string) (*RunResult, error) {
+	if len(c.Renames) > 0 {
+		// renamed base results are written to ResultsDir
+		err := os.MkdirAll(c.ResultsDir, 0o700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.compare(&runBenchmarksResults{
+		baseOutputFile:     baseFile,
+		worktreeOutputFile: headFile,
+	})
+}
+
+// compare runs benchstat on the results of runBenchmarks
+func (c *Benchdiff) compare(res *runBenchmarksResults) (*RunResult, error) {
+	var err error
+	baseFile := res.baseOutputFile
+	if len(c.Renames) > 0 {
+		baseFile, err = c.renameBaseBenchmarks(baseFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	collection, err := c.Benchstat.Run(baseFile, res.worktreeOutputFile)
 	if err != nil {
 		return nil, err
 	}
+	comparison := c.Benchstat.Compare(collection)
 	result := &RunResult{
-		headSHA:  res.headSHA,
-		baseSHA:  res.baseSHA,
-		benchCmd: res.benchmarkCmd,
-		tables:   collection.Tables(),
+		headSHA:        res.headSHA,
+		baseSHA:        res.baseSHA,
+		benchCmd:       res.benchmarkCmd,
+		tables:         comparison.Tables,
+		pValues:        comparison.PValues,
+		rowPValues:     comparison.RowPValues,
+		cis:            comparison.ConfidenceIntervals,
+		failures:       res.failures,
+		procs:          c.procs(),
+		baseOutputFile: res.baseOutputFile,
+		headOutputFile: res.worktreeOutputFile,
+	}
+	removed, added := oneSidedBenchmarks(collection)
+	result.removed, result.added, result.renamed = detectRenames(removed, added)
+	if res.baseSHA != "" && res.headSHA != "" {
+		result.accepts, err = c.readAccepts(res.baseSHA, res.headSHA)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return result, nil
 }
 
 // RunResult is the result of a Run
 type RunResult struct {
-	headSHA  string
-	baseSHA  string
-	benchCmd string
-	tables   []*benchstat.Table
+	headSHA    string
+	baseSHA    string
+	benchCmd   string
+	tables     []*benchstat.Table
+	pValues    []benchstatter.PValue                              // set when p-values are corrected for multiple comparisons
+	rowPValues map[*benchstat.Row]float64                         // the p-value of every tested row after any correction
+	cis        map[*benchstat.Row]benchstatter.ConfidenceInterval // set when there is a confidence level
+	failures   []Failure
+	added      []BenchmarkID
+	removed    []BenchmarkID
+	renamed    []BenchmarkRename
+	accepts    []Accept // from commits between base and head
+	procs      []int    // GOMAXPROCS values to strip from benchmark names
+
+	selectChanged bool
+	selected      []SelectedPackage
+
+	baseOutputFile string
+	headOutputFile string
+}
+
+// AddedBenchmarks returns benchmarks that only have results in head
+func (r *RunResult) AddedBenchmarks() []BenchmarkID {
+	return r.added
+}
+
+// RemovedBenchmarks returns benchmarks that only have results in base
+func (r *RunResult) RemovedBenchmarks() []BenchmarkID {
+	return r.removed
+}
+
+// RenamedBenchmarks returns benchmarks that appear to have been renamed between base and head.
+// These are not included in AddedBenchmarks or RemovedBenchmarks, but HasRemovedBenchmarks still
+// counts them because the pairing is only a guess.
+func (r *RunResult) RenamedBenchmarks() []BenchmarkRename {
+	return r.renamed
 }
 
 // RunResultOutputOptions options for RunResult.WriteOutput
@@ -251,6 +492,11 @@ type RunResultOutputOptions struct {
 	BenchstatFormatter benchstatter.OutputFormatter // default benchstatter.TextFormatter(nil)
 	OutputFormat       string                       // one of json or human. default: human
 	Tolerance          float64
+	ToleranceRules     []ToleranceRule    // override Tolerance for matching rows
+	MinDeltas          map[string]float64 // see DegradeOptions.MinDeltas
+	GeomeanTolerances  map[string]float64 // see DegradeOptions.GeomeanTolerances
+	Gates              []*Gate
+	Markdown           bool // format the sections benchdiff adds to human output as markdown
 }
 
 // WriteOutput outputs the result
@@ -262,6 +508,11 @@ func (r *RunResult) WriteOutput(w io.Writer, opts *RunResultOutputOptions) error
 		BenchstatFormatter: benchstatter.TextFormatter(nil),
 		OutputFormat:       "human",
 		Tolerance:          opts.Tolerance,
+		ToleranceRules:     opts.ToleranceRules,
+		MinDeltas:          opts.MinDeltas,
+		GeomeanTolerances:  opts.GeomeanTolerances,
+		Gates:              opts.Gates,
+		Markdown:           opts.Markdown,
 	}
 	if opts.BenchstatFormatter != nil {
 		finalOpts.BenchstatFormatter = opts.BenchstatFormatter
@@ -277,75 +528,170 @@ func (r *RunResult) WriteOutput(w io.Writer, opts *RunResultOutputOptions) error
 		return err
 	}
 
+	verdicts := &resultVerdicts{
+		geomeans:    r.GeomeanResults(finalOpts.GeomeanTolerances),
+		failedGates: r.CheckGates(finalOpts.Gates),
+	}
+	verdicts.degraded, verdicts.accepted = r.degradedRows(&DegradeOptions{
+		Tolerance:         finalOpts.Tolerance,
+		Rules:             finalOpts.ToleranceRules,
+		MinDeltas:         finalOpts.MinDeltas,
+		GeomeanTolerances: finalOpts.GeomeanTolerances,
+	})
 	switch finalOpts.OutputFormat {
 	case "human":
-		return r.writeHumanResult(w, benchstatBuf.String())
+		return r.writeHumanResult(w, benchstatBuf.String(), verdicts, finalOpts.Markdown)
 	case "json":
-		return r.writeJSONResult(w, benchstatBuf.String(), finalOpts.Tolerance)
+		return r.writeJSONResult(w, benchstatBuf.String(), verdicts)
 	default:
 		return fmt.Errorf("unknown OutputFormat")
 	}
 }
 
-func (r *RunResult) writeJSONResult(w io.Writer, benchstatResult string, tolerance float64) error {
+// resultVerdicts are the pass/fail decisions in WriteOutput
+type resultVerdicts struct {
+	degraded    []DegradedRow
+	accepted    []DegradedRow
+	geomeans    []GeomeanResult
+	failedGates []GateResult
+}
+
+func (r *RunResult) writeJSONResult(w io.Writer, benchstatResult string, verdicts *resultVerdicts) error {
 	type runResultJSON struct {
 		BenchCommand    string `json:"bench_command,omitempty"`
 		HeadSHA         string `json:"head_sha,omitempty"`
 		BaseSHA         string `json:"base_sha,omitempty"`
 		DegradedResult  bool   `json:"degraded_result"`
 		BenchstatOutput string `json:"benchstat_output,omitempty"`
+
+		DegradedBenchmarks []DegradedRow      `json:"degraded_benchmarks,omitempty"`
+		AcceptedBenchmarks []DegradedRow      `json:"accepted_benchmarks,omitempty"`
+		Geomeans           []GeomeanResult    `json:"geomeans,omitempty"`
+		FailedGates        []GateResult       `json:"failed_gates,omitempty"`
+		AddedBenchmarks    []BenchmarkID      `json:"added_benchmarks,omitempty"`
+		RemovedBenchmarks  []BenchmarkID      `json:"removed_benchmarks,omitempty"`
+		RenamedBenchmarks  []BenchmarkRename  `json:"renamed_benchmarks,omitempty"`
+		Failures           []Failure          `json:"failures,omitempty"`
+		AdjustedPValues    []AdjustedPValue   `json:"adjusted_p_values,omitempty"`
+		SelectedPackages   *[]SelectedPackage `json:"selected_packages,omitempty"` // set when packages were selected from changes
+	}
+	var selected *[]SelectedPackage
+	if r.selectChanged {
+		selected = &[]SelectedPackage{}
+		*selected = append(*selected, r.selected...)
 	}
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 	return encoder.Encode(&runResultJSON{
-		BenchCommand:    r.benchCmd,
-		BenchstatOutput: benchstatResult,
-		HeadSHA:         r.headSHA,
-		BaseSHA:         r.baseSHA,
-		DegradedResult:  r.HasDegradedResult(tolerance),
+		BenchCommand:       r.benchCmd,
+		BenchstatOutput:    benchstatResult,
+		HeadSHA:            r.headSHA,
+		BaseSHA:            r.baseSHA,
+		DegradedResult:     len(verdicts.degraded) > 0,
+		DegradedBenchmarks: verdicts.degraded,
+		AcceptedBenchmarks: verdicts.accepted,
+		Geomeans:           verdicts.geomeans,
+		FailedGates:        verdicts.failedGates,
+		AddedBenchmarks:    r.added,
+		RemovedBenchmarks:  r.removed,
+		RenamedBenchmarks:  r.renamed,
+		Failures:           r.failures,
+		AdjustedPValues:    r.AdjustedPValues(),
+		SelectedPackages:   selected,
 	})
 }
 
-func (r *RunResult) writeHumanResult(w io.Writer, benchstatResult string) error {
+func (r *RunResult) writeHumanResult(w io.Writer, benchstatResult string, verdicts *resultVerdicts, markdown bool) error {
 	var err error
-	_, err = fmt.Fprintf(w, "bench command:\n  %s\n", r.benchCmd)
+	// these are empty when comparing existing results
+	for _, header := range []struct{ name, value string }{
+		{name: "bench command", value: r.benchCmd},
+		{name: "HEAD sha", value: r.headSHA},
+		{name: "base sha", value: r.baseSHA},
+	} {
+		if header.value == "" {
+			continue
+		}
+		_, err = fmt.Fprintf(w, "%s:\n  %s\n", header.name, header.value)
+		if err != nil {
+			return err
+		}
+	}
+	selectedItems := selectedPackageItems(r.selected)
+	if r.selectChanged && len(selectedItems) == 0 {
+		selectedItems = []sectionItem{{title: "none"}}
+	}
+	err = writeSection(w, markdown, "selected packages", selectedItems)
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintf(w, "HEAD sha:\n  %s\n", r.headSHA)
+	_, err = fmt.Fprintf(w, "benchstat output:\n\n%s\n", benchstatResult)
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintf(w, "base sha:\n  %s\n", r.baseSHA)
+	err = writeSection(w, markdown, "geomean", geomeanResultItems(verdicts.geomeans))
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintf(w, "benchstat output:\n\n%s\n", benchstatResult)
+	err = writeSection(w, markdown, "degraded benchmarks", degradedRowItems(verdicts.degraded))
 	if err != nil {
 		return err
 	}
+	err = writeSection(w, markdown, "accepted benchmarks", acceptedRowItems(verdicts.accepted))
+	if err != nil {
+		return err
+	}
+	err = writeSection(w, markdown, "failed gates", gateResultItems(verdicts.failedGates))
+	if err != nil {
+		return err
+	}
+	err = writeSection(w, markdown, "added benchmarks", benchmarkIDItems(r.added))
+	if err != nil {
+		return err
+	}
+	err = writeSection(w, markdown, "removed benchmarks", benchmarkIDItems(r.removed))
+	if err != nil {
+		return err
+	}
+	err = writeSection(w, markdown, "renamed benchmarks", benchmarkRenameItems(r.renamed))
+	if err != nil {
+		return err
+	}
+	return writeSection(w, markdown, "failures", failureItems(r.failures))
+}
+
+// HasImprovedResult returns true if any row has a statistically significant improvement
+func (r *RunResult) HasImprovedResult() bool {
+	for _, row := range r.Rows() {
+		if row.Change == ImprovingChange {
+			return true
+		}
+	}
+	return false
+}
 
-	return nil
+// HasFailures returns true if benchmarks or packages failed on either side
+func (r *RunResult) HasFailures() bool {
+	return len(r.failures) > 0
 }
 
-// HasDegradedResult returns true if there are any rows with DegradingChange and PctDelta over tolerance
-func (r *RunResult) HasDegradedResult(tolerance float64) bool {
-	return r.maxDegradedPct() > tolerance
+// IsEmpty returns true when there are no results to compare on either side. That happens when no
+// benchmarks match or none of them ran.
+func (r *RunResult) IsEmpty() bool {
+	return len(r.Rows()) == 0 && len(r.added) == 0 && len(r.removed) == 0 && len(r.renamed) == 0
 }
 
-func (r *RunResult) maxDegradedPct() float64 {
-	max := 0.0
-	for _, table := range r.tables {
-		for _, row := range table.Rows {
-			if row.Change != DegradingChange {
-				continue
-			}
-			if row.PctDelta > max {
-				max = row.PctDelta
-			}
-		}
-	}
-	return max
+// HasRemovedBenchmarks returns true if any benchmarks in base are missing from head, including
+// benchmarks that appear to have been renamed
+func (r *RunResult) HasRemovedBenchmarks() bool {
+	return len(r.removed) > 0 || len(r.renamed) > 0
+}
+
+// HasDegradedResult returns true if there are any rows with DegradingChange and PctDelta over
+// tolerance or the tolerance of the first rule that matches the row. Rows accepted by a
+// Benchdiff-Accept trailer don't count.
+func (r *RunResult) HasDegradedResult(tolerance float64, rules ...ToleranceRule) bool {
+	return len(r.DegradedRows(&DegradeOptions{Tolerance: tolerance, Rules: rules})) > 0
 }
 
 // BenchmarkChangeType is whether a change is an improvement or degradation
@@ -1,8 +1,10 @@
 package internal
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -57,6 +59,445 @@ func TestBenchdiff_Run(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestBenchdiff_Run_buildTime(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	differ := Benchdiff{
+		GitCmd: "git",
+		// echo stands in for go so the test doesn't wait on builds with an empty cache.
+		BenchCmd:   "echo",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+		BuildTime: &BuildTimeOptions{
+			Packages: []string{"."},
+			Count:    2,
+		},
+	}
+	result, err := differ.Run()
+	require.NoError(t, err)
+	require.Equal(t, "echo build . && echo vet .", result.benchCmd)
+	require.Len(t, result.tables, 1)
+	require.Len(t, result.tables[0].Rows, 2)
+	require.Equal(t, "GoBuild", result.tables[0].Rows[0].Benchmark)
+	require.Equal(t, "GoVet", result.tables[0].Rows[1].Benchmark)
+}
+
+func TestBenchdiff_Run_command(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	differ := Benchdiff{
+		GitCmd:     "git",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+		Command: &CommandOptions{
+			Build: "go vet .",
+			Run:   "go list .",
+			Count: 3,
+		},
+	}
+	result, err := differ.Run()
+	require.NoError(t, err)
+	require.Equal(t, "go vet . && go list .", result.benchCmd)
+	var metrics []string
+	for _, table := range result.tables {
+		require.Len(t, table.Rows, 1)
+		require.Equal(t, "Command", table.Rows[0].Benchmark)
+		metrics = append(metrics, table.Metric)
+	}
+	require.Equal(t, []string{"time/op", "user-time/op", "sys-time/op", "peak-RSS-B"}, metrics)
+}
+
+func TestBenchdiff_Run_resourceUsage(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	differ := Benchdiff{
+		GitCmd:     "git",
+		BenchCmd:   "go",
+		BenchArgs:  "test -bench . -count 2 -benchtime 10x .",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+		Packages:   []string{"./..."},
+		PackageBenchArgs: func(pkg string) (string, error) {
+			return "test -bench . -count 2 -benchtime 10x " + pkg, nil
+		},
+		ResourceUsage: true,
+	}
+	result, err := differ.Run()
+	require.NoError(t, err)
+	metrics := map[string][]string{}
+	for _, table := range result.tables {
+		for _, row := range table.Rows {
+			metrics[row.Benchmark] = append(metrics[row.Benchmark], table.Metric)
+		}
+	}
+	require.Equal(t, []string{"time/op"}, metrics["DoNothing"])
+	require.Equal(t, []string{"peak-RSS-B", "user-ns", "sys-ns", "vol-ctxsw", "invol-ctxsw"}, metrics["GoTestProcess"])
+	for _, table := range result.tables {
+		for _, row := range table.Rows {
+			// one sample per run of the test binary for each -count
+			require.Len(t, row.Metrics[0].RValues, 2, row.Benchmark)
+			require.Len(t, row.Metrics[1].RValues, 2, row.Benchmark)
+			if row.Benchmark == "GoTestProcess" && table.Metric == "peak-RSS-B" {
+				// the test binary alone, not go test with the compiler and linker it runs
+				require.Less(t, row.Metrics[1].Mean, 60e6)
+			}
+		}
+	}
+}
+
+func TestBenchdiff_Run_wrapper(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	runner := new(recordingRunner)
+	differ := Benchdiff{
+		GitCmd:     "git",
+		BenchCmd:   "go",
+		BenchArgs:  "test -bench . -count 2 -benchtime 10x .",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+		Wrapper:    "env BENCHDIFF_SIDE={{ .Side }}",
+		Runner:     runner,
+	}
+	result, err := differ.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Rows(), 1)
+	var wrapped []string
+	for _, cmd := range runner.commands {
+		if strings.HasPrefix(cmd, "env ") || strings.HasPrefix(cmd, "go test") {
+			wrapped = append(wrapped, cmd)
+		}
+	}
+	require.Equal(t, []string{
+		"env BENCHDIFF_SIDE=base go test -bench . -count 2 -benchtime 10x .",
+		"env BENCHDIFF_SIDE=head go test -bench . -count 2 -benchtime 10x .",
+	}, wrapped)
+}
+
+func TestBenchdiff_Run_allowPartial(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	err := os.MkdirAll(filepath.Join(dir, "ex2"), 0o700)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "ex2", "ex2_test.go"), []byte(ex2Bench), 0o600)
+	require.NoError(t, err)
+	pkgArgs := func(pkg string) (string, error) {
+		return "test -bench . -count 2 -benchtime 10x " + pkg, nil
+	}
+	differ := Benchdiff{
+		GitCmd:           "git",
+		BenchCmd:         "go",
+		BenchArgs:        "test -bench . -count 2 -benchtime 10x . ./ex2",
+		ResultsDir:       "./tmp",
+		BaseRef:          "HEAD",
+		Path:             ".",
+		Benchstat:        &benchstatter.Benchstat{SplitBy: []string{"pkg"}},
+		Packages:         []string{".", "./ex2"},
+		PackageBenchArgs: pkgArgs,
+		AllowPartial:     true,
+	}
+	result, err := differ.Run()
+	require.NoError(t, err)
+	require.Len(t, result.failures, 1)
+	require.Equal(t, SideBase, result.failures[0].Side)
+	require.Equal(t, "./ex2", result.failures[0].Package)
+	require.Empty(t, result.RemovedBenchmarks())
+	require.Equal(t, []BenchmarkID{{
+		Group:     "pkg:bindiff.test/ex2",
+		Benchmark: "Ex2",
+	}}, result.AddedBenchmarks())
+
+	// the failure is still reported when base results come from the cache
+	result, err = differ.Run()
+	require.NoError(t, err)
+	require.Len(t, result.failures, 1)
+}
+
+func TestBenchdiff_Run_benchmarkFailures(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	ex1test := filepath.Join(dir, "ex1_test.go")
+	err := os.WriteFile(ex1test, []byte(ex1Bench+ex1FailingBench), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		GitCmd:     "git",
+		BenchCmd:   "go",
+		BenchArgs:  "test -bench . -count 2 -benchtime 10x .",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+	}
+	_, err = differ.Run()
+	var failuresErr *BenchmarkFailuresError
+	require.ErrorAs(t, err, &failuresErr)
+	require.Len(t, failuresErr.Failures, 1)
+
+	differ.ContinueOnFailure = true
+	result, err := differ.Run()
+	require.NoError(t, err)
+	require.Equal(t, []Failure{{
+		Side:      SideHead,
+		Package:   "bindiff.test",
+		Benchmark: "BenchmarkFails",
+		Reason:    "ex1_test.go:16: oops",
+	}}, result.failures)
+	require.Len(t, result.tables, 1)
+	require.Equal(t, "DoNothing", result.tables[0].Rows[0].Benchmark)
+}
+
+func TestBenchdiff_Run_testJSON(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	err := os.WriteFile(filepath.Join(dir, "chatty_test.go"), []byte(chattyBench), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		GitCmd:     "git",
+		BenchCmd:   "go",
+		BenchArgs:  "test -bench . -count 2 -benchtime 10x .",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+		TestJSON:   true,
+	}
+	result, err := differ.Run()
+	require.NoError(t, err)
+	require.Len(t, result.tables, 1)
+	row := result.tables[0].Rows[0]
+	require.Equal(t, "DoNothing", row.Benchmark)
+	// every sample is kept even though go test only sets Test on the first one
+	require.Len(t, row.Metrics[0].RValues, 2)
+	require.Len(t, row.Metrics[1].RValues, 2)
+	require.Equal(t, []BenchmarkID{{Benchmark: "Chatty"}}, result.AddedBenchmarks())
+	headResults, err := os.ReadFile(result.headOutputFile)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(headResults), "BenchmarkChatty"))
+	logs, err := os.ReadFile(filepath.Join("tmp", "benchdiff-worktree.logs", "bindiff.test.log"))
+	require.NoError(t, err)
+	require.Contains(t, string(logs), "chatter")
+}
+
+func TestBenchdiff_Run_progress(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	var progressBuf bytes.Buffer
+	differ := Benchdiff{
+		GitCmd:     "git",
+		BenchCmd:   "go",
+		BenchArgs:  "test -bench . -count 2 -benchtime 10x .",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+		Count:      2,
+	}
+	timingsFile := filepath.Join("tmp", "benchdiff-timings.json")
+
+	// timings are only kept for the progress display
+	_, err := differ.Run()
+	require.NoError(t, err)
+	require.NoFileExists(t, timingsFile)
+
+	// a broken timings file is no history
+	err = os.WriteFile(timingsFile, []byte("not json"), 0o600)
+	require.NoError(t, err)
+	differ.Progress = &progressBuf
+	differ.Force = true
+	_, err = differ.Run()
+	require.NoError(t, err)
+	require.Contains(t, progressBuf.String(), "[base] bindiff.test BenchmarkDoNothing")
+	require.Contains(t, progressBuf.String(), " 2/2 (")
+	require.Contains(t, progressBuf.String(), "[head] done in ")
+	require.NotContains(t, progressBuf.String(), " left)")
+	require.Len(t, readTimings(timingsFile), 2)
+}
+
+func TestBenchdiff_Compare(t *testing.T) {
+	dir := t.TempDir()
+	baseFile := filepath.Join(dir, "old.txt")
+	headFile := filepath.Join(dir, "new.txt")
+	err := os.WriteFile(baseFile, []byte("BenchmarkFoo 1 100 ns/op\nBenchmarkFoo 1 101 ns/op\nBenchmarkFoo 1 99 ns/op\nBenchmarkFoo 1 100 ns/op\n"), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(headFile, []byte("BenchmarkFoo 1 200 ns/op\nBenchmarkFoo 1 201 ns/op\nBenchmarkFoo 1 199 ns/op\nBenchmarkFoo 1 200 ns/op\n"), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		Benchstat: &benchstatter.Benchstat{},
+	}
+	result, err := differ.Compare(baseFile, headFile)
+	require.NoError(t, err)
+	require.True(t, result.HasDegradedResult(10))
+	var buf bytes.Buffer
+	err = result.WriteOutput(&buf, nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(buf.String(), "benchstat output:\n"))
+}
+
+func TestBenchdiff_Compare_removedAndAdded(t *testing.T) {
+	dir := t.TempDir()
+	baseFile := filepath.Join(dir, "old.txt")
+	headFile := filepath.Join(dir, "new.txt")
+	// BenchmarkEncodeJSON is deleted and an unrelated BenchmarkEncode_JSON is added
+	err := os.WriteFile(baseFile, []byte("BenchmarkFoo 1 100 ns/op\nBenchmarkEncodeJSON 1 100 ns/op\nBenchmarkDecode 1 100 ns/op\n"), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(headFile, []byte("BenchmarkFoo 1 100 ns/op\nBenchmarkEncode_JSON 1 100 ns/op\nBenchmarkMarshal 1 100 ns/op\n"), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		Benchstat: &benchstatter.Benchstat{},
+	}
+	result, err := differ.Compare(baseFile, headFile)
+	require.NoError(t, err)
+	require.Equal(t, []BenchmarkID{{Benchmark: "Decode"}}, result.RemovedBenchmarks())
+	require.Equal(t, []BenchmarkID{{Benchmark: "Marshal"}}, result.AddedBenchmarks())
+	require.Equal(t, []BenchmarkRename{{Old: "EncodeJSON", New: "Encode_JSON"}}, result.RenamedBenchmarks())
+	require.True(t, result.HasRemovedBenchmarks())
+
+	// a guessed rename alone still counts as a removal
+	err = os.WriteFile(baseFile, []byte("BenchmarkFoo 1 100 ns/op\nBenchmarkEncodeJSON 1 100 ns/op\n"), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(headFile, []byte("BenchmarkFoo 1 100 ns/op\nBenchmarkEncode_JSON 1 100 ns/op\n"), 0o600)
+	require.NoError(t, err)
+	result, err = differ.Compare(baseFile, headFile)
+	require.NoError(t, err)
+	require.Empty(t, result.RemovedBenchmarks())
+	require.True(t, result.HasRemovedBenchmarks())
+}
+
+func TestBenchdiff_Compare_correction(t *testing.T) {
+	dir := t.TempDir()
+	baseFile := filepath.Join(dir, "old.txt")
+	headFile := filepath.Join(dir, "new.txt")
+	err := os.WriteFile(baseFile, []byte(`BenchmarkFoo 1 100 ns/op
+BenchmarkFoo 1 101 ns/op
+BenchmarkFoo 1 99 ns/op
+BenchmarkFoo 1 100 ns/op
+BenchmarkBar 1 100 ns/op
+BenchmarkBar 1 101 ns/op
+BenchmarkBar 1 99 ns/op
+BenchmarkBar 1 100 ns/op
+`), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(headFile, []byte(`BenchmarkFoo 1 200 ns/op
+BenchmarkFoo 1 201 ns/op
+BenchmarkFoo 1 199 ns/op
+BenchmarkFoo 1 200 ns/op
+BenchmarkBar 1 100 ns/op
+BenchmarkBar 1 102 ns/op
+BenchmarkBar 1 98 ns/op
+BenchmarkBar 1 100 ns/op
+`), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		Benchstat: &benchstatter.Benchstat{},
+	}
+	result, err := differ.Compare(baseFile, headFile)
+	require.NoError(t, err)
+	require.True(t, result.HasDegradedResult(10))
+	require.Nil(t, result.AdjustedPValues())
+	// the exact p-value, not the one rounded to 3 decimals in the note
+	require.InDelta(t, 2.0/70, result.Rows()[0].P, 1e-9)
+
+	// with four samples on each side, the smallest p-value the u-test gives is about 0.03
+	differ.Benchstat.Correction = benchstatter.Bonferroni
+	result, err = differ.Compare(baseFile, headFile)
+	require.NoError(t, err)
+	require.False(t, result.HasDegradedResult(10))
+	adjusted := result.AdjustedPValues()
+	require.Len(t, adjusted, 2)
+	require.Equal(t, "Foo", adjusted[0].Benchmark)
+	require.Equal(t, "time/op", adjusted[0].Metric)
+	require.InDelta(t, 2*adjusted[0].P, adjusted[0].AdjustedP, 1e-9)
+	require.Equal(t, adjusted[0].AdjustedP, result.Rows()[0].P)
+
+	var buf bytes.Buffer
+	err = result.WriteOutput(&buf, &RunResultOutputOptions{OutputFormat: "json"})
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `"adjusted_p_values": [`)
+}
+
+func TestBenchdiff_Compare_confidenceLevel(t *testing.T) {
+	dir := t.TempDir()
+	baseFile := filepath.Join(dir, "old.txt")
+	headFile := filepath.Join(dir, "new.txt")
+	err := os.WriteFile(baseFile, []byte("BenchmarkFoo 1 100 ns/op\nBenchmarkFoo 1 101 ns/op\nBenchmarkFoo 1 99 ns/op\nBenchmarkFoo 1 100 ns/op\n"), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(headFile, []byte("BenchmarkFoo 1 200 ns/op\nBenchmarkFoo 1 201 ns/op\nBenchmarkFoo 1 199 ns/op\nBenchmarkFoo 1 200 ns/op\n"), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		Benchstat: &benchstatter.Benchstat{
+			DeltaTest:       benchstatter.PermutationTest,
+			ConfidenceLevel: 0.9,
+		},
+	}
+	result, err := differ.Compare(baseFile, headFile)
+	require.NoError(t, err)
+	rows := result.Rows()
+	require.Len(t, rows, 1)
+	require.NotNil(t, rows[0].CI)
+	require.Equal(t, 0.9, rows[0].CI.Level)
+	require.LessOrEqual(t, rows[0].CI.Low, rows[0].CI.High)
+	require.InDelta(t, 100, rows[0].CI.Low, 2)
+
+	var buf bytes.Buffer
+	err = result.WriteOutput(&buf, &RunResultOutputOptions{Tolerance: 10})
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "+100.00% "+rows[0].CI.String())
+
+	buf.Reset()
+	err = result.WriteOutput(&buf, &RunResultOutputOptions{OutputFormat: "json"})
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `"ci": {`)
+}
+
+var chattyBench = `
+package ex1
+
+import (
+	"fmt"
+	"testing"
+)
+
+func BenchmarkChatty(b *testing.B) {
+	fmt.Println("chatter")
+	for i := 0; i < b.N; i++ {
+	}
+}
+`
+
+var ex1FailingBench = `
+func BenchmarkFails(b *testing.B) {
+	b.Fatal("oops")
+}
+`
+
+var ex2Bench = `
+package ex2
+
+import (
+	"testing"
+)
+
+func BenchmarkEx2(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+	}
+}
+`
+
 var ex1Rev1 = `
 package ex1
 
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// BuildTimeOptions configures Benchdiff to compare the time it takes to build
+// packages instead of running benchmarks.
+type BuildTimeOptions struct {
+	Packages []string // packages to build and vet
+	Tags     string   // value for -tags
+	Count    int      // how many times to build each side. default: 1
+}
+
+type buildTimeStep struct {
+	benchName string
+	goArgs    []string
+}
+
+var buildTimeSteps = []buildTimeStep{
+	{benchName: "BenchmarkGoBuild", goArgs: []string{"build"}},
+	{benchName: "BenchmarkGoVet", goArgs: []string{"vet"}},
+}
+
+func (o *BuildTimeOptions) count() int {
+	if o.Count < 1 {
+		return 1
+	}
+	return o.Count
+}
+
+func (o *BuildTimeOptions) stepArgs(step buildTimeStep) []string {
+	args := append([]string{}, step.goArgs...)
+	if o.Tags != "" {
+		args = append(args, "-tags", o.Tags)
+	}
+	return append(args, o.Packages...)
+}
+
+func (o *BuildTimeOptions) cmdline(goCmd string) string {
+	cmds := make([]string, len(buildTimeSteps))
+	for i, step := range buildTimeSteps {
+		cmds[i] = goCmd + " " + strings.Join(o.stepArgs(step), " ")
+	}
+	return strings.Join(cmds, " && ")
+}
+
+// timeBuilds runs each of buildTimeSteps c.BuildTime.Count times in dir and writes the timings
+// to w as benchmark results.
+func (c *Benchdiff) timeBuilds(goCmd, dir string, w io.Writer, side *WrapperData) error {
+	if w == nil {
+		w = io.Discard
+	}
+	for i := 0; i < c.BuildTime.count(); i++ {
+		for _, step := range buildTimeSteps {
+			elapsed, err := c.timeBuildStep(goCmd, dir, step, side)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "%s\t1\t%d ns/op\n", step.benchName, elapsed.Nanoseconds())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// timeBuildStep runs a single step with an empty GOCACHE and returns how long it took.
+func (c *Benchdiff) timeBuildStep(goCmd, dir string, step buildTimeStep, side *WrapperData) (time.Duration, error) {
+	cacheDir, err := os.MkdirTemp("", "benchdiff-gocache")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		rErr := os.RemoveAll(cacheDir)
+		if rErr != nil {
+			c.debug().Printf("could not delete temp directory %s: %v", cacheDir, rErr)
+		}
+	}()
+	cmd := NewCommand(goCmd, c.BuildTime.stepArgs(step)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOCACHE="+cacheDir)
+	start := time.Now()
+	_, err = c.runWrapped(cmd, side)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,306 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SelectedPackage is a package chosen by Benchdiff.SelectChanged and the reason it was chosen
+type SelectedPackage struct {
+	Package string `json:"package"`
+	Reason  string `json:"reason"`
+	Side    string `json:"side,omitempty"` // the only side that has the package. Empty when both sides do.
+}
+
+// runChanged runs benchmarks in the packages chosen by selectChangedPackages
+func (c *Benchdiff) runChanged() (*RunResult, error) {
+	if c.PackageBenchArgs == nil {
+		return nil, fmt.Errorf("PackageBenchArgs is required to select changed packages")
+	}
+	selected, err := c.selectChangedPackages()
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		c.debug().Printf("no packages with benchmarks are affected by changes since %s", c.BaseRef)
+		var result *RunResult
+		result, err = c.emptyResult()
+		if err != nil {
+			return nil, err
+		}
+		result.selectChanged = true
+		return result, nil
+	}
+	differ := *c
+	differ.SelectChanged = false
+	differ.Packages = make([]string, len(selected))
+	for i, s := range selected {
+		differ.Packages[i] = s.Package
+		if s.Side != "" {
+			// go test fails on the side that doesn't have the package, so run each package
+			// separately and report its benchmarks as added or removed
+			differ.AllowPartial = true
+		}
+	}
+	differ.BenchArgs, err = c.PackageBenchArgs(strings.Join(differ.Packages, " "))
+	if err != nil {
+		return nil, err
+	}
+	result, err := differ.Run()
+	if err != nil {
+		return nil, err
+	}
+	result.selectChanged = true
+	result.selected = selected
+	return result, nil
+}
+
+// changedFiles returns the files that differ between c.BaseRef and the worktree including untracked
+// files. Paths are relative to the root of the repository.
+func (c *Benchdiff) changedFiles() ([]string, error) {
+	diff, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "diff", "--name-only", c.BaseRef)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, out := range [][]byte{diff, untracked} {
+		for _, line := range strings.Split(string(out), "\n") {
+			if line != "" {
+				files = append(files, line)
+			}
+		}
+	}
+	return files, nil
+}
+
+var benchFuncRegexp = regexp.MustCompile(`(?m)^func Benchmark`)
+
+// hasBenchmarks returns true when any of pkg's test files declare a benchmark
+func (p *listedPackage) hasBenchmarks() bool {
+	for _, name := range append(append([]string{}, p.TestGoFiles...), p.XTestGoFiles...) {
+		data, err := os.ReadFile(filepath.Join(p.Dir, name))
+		if err == nil && benchFuncRegexp.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTestVariant returns true for the packages go list -test adds to build tests, like
+// "example.com/foo [example.com/foo.test]" and the generated main package "example.com/foo.test"
+func (p *listedPackage) isTestVariant() bool {
+	return p.ForTest != "" || p.Name == "main" && strings.HasSuffix(p.ImportPath, ".test")
+}
+
+// selectChangedPackages returns the packages in c.Packages that have benchmarks and are affected
+// by files changed since c.BaseRef. A package is affected when it contains a changed file, when it
+// depends on a package that does (the Deps reported by go list -deps) or when its tests import one.
+// Packages are selected on both sides so packages added or removed since c.BaseRef are too.
+func (c *Benchdiff) selectChangedPackages() ([]SelectedPackage, error) {
+	files, err := c.changedFiles()
+	if err != nil {
+		return nil, err
+	}
+	root, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	head, err := c.indexPackages(c.Path, string(root))
+	if err != nil {
+		return nil, err
+	}
+	var selected []SelectedPackage
+	var selectErr error
+	err = runAtGitRef(c.runner(), c.debug(), c.gitCmd(), c.Path, c.BaseRef, func(workPath string) {
+		// base's packages are selected here because hasBenchmarks reads the worktree's files
+		var base *packageIndex
+		base, selectErr = c.indexPackages(workPath, workPath)
+		if selectErr != nil {
+			return
+		}
+		changed, moduleChanged := changedPackages(files, head, base)
+		selected = mergeSelected(
+			head.selectPackages(changed, moduleChanged), base.selectPackages(changed, moduleChanged),
+			head.loaded(), base.loaded(),
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if selectErr != nil {
+		return nil, selectErr
+	}
+	return selected, nil
+}
+
+// packageIndex is the packages go list -deps -test reports for c.Packages in one side's worktree
+type packageIndex struct {
+	root   string // the root of the worktree
+	pkgs   []listedPackage
+	byDir  map[string]string
+	byPath map[string]*listedPackage
+}
+
+// indexPackages lists the packages in dir, the worktree of one side. root is the root of the
+// worktree.
+func (c *Benchdiff) indexPackages(dir, root string) (*packageIndex, error) {
+	listCmd := NewCommand(c.BenchCmd)
+	listCmd.Dir = dir
+	// -deps -test lists the packages c.Packages and their tests depend on too, so a changed package
+	// outside c.Packages is still found
+	pkgs, err := c.listPackages(listCmd, "-deps", "-test")
+	if err != nil {
+		return nil, err
+	}
+	idx := &packageIndex{
+		root:   evalSymlinks(root),
+		pkgs:   pkgs,
+		byDir:  map[string]string{},
+		byPath: map[string]*listedPackage{},
+	}
+	for i := range pkgs {
+		pkg := &pkgs[i]
+		if pkg.isTestVariant() {
+			continue
+		}
+		idx.byPath[pkg.ImportPath] = pkg
+		if pkg.Dir != "" {
+			idx.byDir[evalSymlinks(pkg.Dir)] = pkg.ImportPath
+		}
+	}
+	return idx, nil
+}
+
+// packageOf returns the package containing file, a path relative to the root of the worktree.
+// Files in subdirectories like testdata belong to the closest package above them.
+func (idx *packageIndex) packageOf(file string) (string, bool) {
+	dir := filepath.Dir(filepath.Join(idx.root, filepath.FromSlash(file)))
+	for dir == idx.root || strings.HasPrefix(dir, idx.root+string(filepath.Separator)) {
+		if pkg, ok := idx.byDir[dir]; ok {
+			return pkg, true
+		}
+		dir = filepath.Dir(dir)
+	}
+	return "", false
+}
+
+// changedPackages maps each package with changed files to the first of its changed files. Files
+// are looked up on the side that has them, so a file deleted since the base ref belongs to its
+// package at base instead of a package above it at head. moduleChanged is the first changed
+// go.mod, go.sum or go.work.
+func changedPackages(files []string, head, base *packageIndex) (changed map[string]string, moduleChanged string) {
+	changed = map[string]string{}
+	for _, file := range files {
+		if name := filepath.Base(file); name == "go.mod" || name == "go.sum" || name == "go.work" {
+			if moduleChanged == "" {
+				moduleChanged = file
+			}
+			continue
+		}
+		idx := head
+		if _, err := os.Stat(filepath.Join(head.root, filepath.FromSlash(file))); err != nil {
+			idx = base
+		}
+		if pkg, ok := idx.packageOf(file); ok && changed[pkg] == "" {
+			changed[pkg] = file
+		}
+	}
+	return changed, moduleChanged
+}
+
+// selectPackages returns the packages in c.Packages that have benchmarks and are affected by
+// the changed packages
+func (idx *packageIndex) selectPackages(changed map[string]string, moduleChanged string) []SelectedPackage {
+	var selected []SelectedPackage
+	for _, pkg := range idx.pkgs {
+		if pkg.DepOnly || pkg.isTestVariant() || pkg.Error != nil || !pkg.hasBenchmarks() {
+			continue
+		}
+		reason := changedReason(&pkg, changed, idx.byPath, moduleChanged)
+		if reason != "" {
+			selected = append(selected, SelectedPackage{Package: pkg.ImportPath, Reason: reason})
+		}
+	}
+	return selected
+}
+
+// loaded returns the packages in c.Packages that can be loaded
+func (idx *packageIndex) loaded() map[string]bool {
+	loaded := map[string]bool{}
+	for _, pkg := range idx.pkgs {
+		if !pkg.DepOnly && !pkg.isTestVariant() && pkg.Error == nil {
+			loaded[pkg.ImportPath] = true
+		}
+	}
+	return loaded
+}
+
+// mergeSelected combines the packages selected on each side sorted by package. Head's reasons take
+// precedence. Side is set for packages that only one side has.
+func mergeSelected(head, base []SelectedPackage, onHead, onBase map[string]bool) []SelectedPackage {
+	byPackage := map[string]SelectedPackage{}
+	for _, s := range base {
+		if !onHead[s.Package] {
+			s.Side = SideBase
+		}
+		byPackage[s.Package] = s
+	}
+	for _, s := range head {
+		if !onBase[s.Package] {
+			s.Side = SideHead
+		}
+		byPackage[s.Package] = s
+	}
+	selected := make([]SelectedPackage, 0, len(byPackage))
+	for _, s := range byPackage {
+		selected = append(selected, s)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Package < selected[j].Package
+	})
+	return selected
+}
+
+// changedReason explains why pkg is affected by the changed packages. It returns "" when pkg isn't affected.
+func changedReason(pkg *listedPackage, changed map[string]string, byPath map[string]*listedPackage, moduleChanged string) string {
+	if file, ok := changed[pkg.ImportPath]; ok {
+		return "contains changed file " + file
+	}
+	for _, dep := range pkg.Deps {
+		if _, ok := changed[dep]; ok {
+			return "depends on changed package " + dep
+		}
+	}
+	for _, imp := range append(append([]string{}, pkg.TestImports...), pkg.XTestImports...) {
+		if _, ok := changed[imp]; ok {
+			return "tests import changed package " + imp
+		}
+		if imported, ok := byPath[imp]; ok {
+			for _, dep := range imported.Deps {
+				if _, ok := changed[dep]; ok {
+					return "tests depend on changed package " + dep
+				}
+			}
+		}
+	}
+	if moduleChanged != "" {
+		return moduleChanged + " changed"
+	}
+	return ""
+}
+
+func evalSymlinks(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return resolved
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/benchdiff/pkg/benchstatter"
+)
+
+func setupChangedRepo(t *testing.T, dir string) {
+	t.Helper()
+	setupTestRepo(t, dir)
+	files := map[string]string{
+		// depends on ex1 and has benchmarks
+		"dep/dep.go":      "package dep\n\nimport _ \"bindiff.test\"\n",
+		"dep/dep_test.go": "package dep\n\nimport \"testing\"\n\nfunc BenchmarkDep(b *testing.B) {}\n",
+		// only its tests import ex1
+		"testdep/testdep.go":      "package testdep\n",
+		"testdep/testdep_test.go": "package testdep\n\nimport (\n\t\"testing\"\n\n\t_ \"bindiff.test/dep\"\n)\n\nfunc BenchmarkTestDep(b *testing.B) {}\n",
+		// depends on ex1 without benchmarks
+		"nobench/nobench.go": "package nobench\n\nimport _ \"bindiff.test\"\n",
+		// unrelated to ex1
+		"other/other.go":      "package other\n",
+		"other/other_test.go": "package other\n\nimport \"testing\"\n\nfunc BenchmarkOther(b *testing.B) {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	mustGit(t, dir, "add", "dep", "testdep", "nobench", "other")
+	mustGit(t, dir, "commit", "-m", "add packages")
+}
+
+func TestBenchdiff_selectChangedPackages(t *testing.T) {
+	dir := t.TempDir()
+	setupChangedRepo(t, dir)
+	differ := Benchdiff{
+		BenchCmd: "go",
+		BaseRef:  "HEAD",
+		Path:     dir,
+		Packages: []string{"./..."},
+	}
+	got, err := differ.selectChangedPackages()
+	require.NoError(t, err)
+	require.Equal(t, []SelectedPackage{
+		{Package: "bindiff.test", Reason: "contains changed file ex1.go"},
+		{Package: "bindiff.test/dep", Reason: "depends on changed package bindiff.test"},
+		{Package: "bindiff.test/testdep", Reason: "tests depend on changed package bindiff.test"},
+	}, got)
+
+	err = os.WriteFile(filepath.Join(dir, "other", "testdata.txt"), []byte("x"), 0o600)
+	require.NoError(t, err)
+	mustGit(t, dir, "checkout", "ex1.go")
+	got, err = differ.selectChangedPackages()
+	require.NoError(t, err)
+	require.Equal(t, []SelectedPackage{
+		{Package: "bindiff.test/other", Reason: "contains changed file other/testdata.txt"},
+	}, got)
+}
+
+func TestBenchdiff_selectChangedPackages_testOnlyImport(t *testing.T) {
+	dir := t.TempDir()
+	setupChangedRepo(t, dir)
+	mustGit(t, dir, "checkout", "ex1.go")
+	// dep isn't in Packages and only testdep's tests import it
+	err := os.WriteFile(filepath.Join(dir, "dep", "dep.go"), []byte("package dep\n\nimport _ \"bindiff.test\"\n\nvar X = 1\n"), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		BenchCmd: "go",
+		BaseRef:  "HEAD",
+		Path:     dir,
+		Packages: []string{"./testdep", "./other"},
+	}
+	got, err := differ.selectChangedPackages()
+	require.NoError(t, err)
+	require.Equal(t, []SelectedPackage{
+		{Package: "bindiff.test/testdep", Reason: "tests import changed package bindiff.test/dep"},
+	}, got)
+
+	// ex1 is a dependency of a package only testdep's tests import
+	mustGit(t, dir, "checkout", "dep/dep.go")
+	err = os.WriteFile(filepath.Join(dir, "ex1.go"), []byte(ex1Rev2), 0o600)
+	require.NoError(t, err)
+	got, err = differ.selectChangedPackages()
+	require.NoError(t, err)
+	require.Equal(t, []SelectedPackage{
+		{Package: "bindiff.test/testdep", Reason: "tests depend on changed package bindiff.test"},
+	}, got)
+}
+
+func TestBenchdiff_Run_selectChanged(t *testing.T) {
+	dir := t.TempDir()
+	setupChangedRepo(t, dir)
+	testInDir(t, dir)
+	differ := Benchdiff{
+		GitCmd:     "git",
+		BenchCmd:   "go",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+		Packages:   []string{"./..."},
+		PackageBenchArgs: func(pkg string) (string, error) {
+			return "test -bench . -count 2 -benchtime 10x " + pkg, nil
+		},
+		SelectChanged: true,
+	}
+	result, err := differ.Run()
+	require.NoError(t, err)
+	require.Len(t, result.selected, 3)
+	require.Equal(t, "go test -bench . -count 2 -benchtime 10x bindiff.test bindiff.test/dep bindiff.test/testdep", result.benchCmd)
+
+	mustGit(t, dir, "checkout", "ex1.go")
+	result, err = differ.Run()
+	require.NoError(t, err)
+	require.True(t, result.selectChanged)
+	require.Empty(t, result.selected)
+	require.Empty(t, result.tables)
+
+	// a package added since the base ref
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "newpkg"), 0o700))
+	err = os.WriteFile(filepath.Join(dir, "newpkg", "n_test.go"), []byte("package newpkg\n\nimport \"testing\"\n\nfunc BenchmarkNew(b *testing.B) {}\n"), 0o600)
+	require.NoError(t, err)
+	result, err = differ.Run()
+	require.NoError(t, err)
+	require.Equal(t, []SelectedPackage{
+		{Package: "bindiff.test/newpkg", Reason: "contains changed file newpkg/n_test.go", Side: SideHead},
+	}, result.selected)
+	require.Len(t, result.AddedBenchmarks(), 1)
+	require.Empty(t, result.RemovedBenchmarks())
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "newpkg")))
+
+	// a package removed since the base ref
+	mustGit(t, dir, "rm", "-r", "-q", "other")
+	result, err = differ.Run()
+	require.NoError(t, err)
+	require.Equal(t, []SelectedPackage{
+		{Package: "bindiff.test/other", Reason: "contains changed file other/other.go", Side: SideBase},
+	}, result.selected)
+	require.Empty(t, result.AddedBenchmarks())
+	require.Len(t, result.RemovedBenchmarks(), 1)
+	require.True(t, result.HasRemovedBenchmarks())
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// CommandOptions configures Benchdiff to time an arbitrary command instead of running go benchmarks.
+type CommandOptions struct {
+	Build string // command run once on each ref before Run. optional
+	Run   string // command to time
+	Count int    // how many times to run the command on each ref. default: 1
+}
+
+const commandBenchName = "BenchmarkCommand"
+
+func (o *CommandOptions) count() int {
+	if o.Count < 1 {
+		return 1
+	}
+	return o.Count
+}
+
+func (o *CommandOptions) cmdline() string {
+	if o.Build == "" {
+		return o.Run
+	}
+	return o.Build + " && " + o.Run
+}
+
+// timeCommand runs c.Command.Build followed by c.Command.Run count times in dir. The wall time,
+// cpu time and peak RSS of each run is written to w as a benchmark result.
+func (c *Benchdiff) timeCommand(dir string, count int, w io.Writer, side *WrapperData) error {
+	if w == nil {
+		w = io.Discard
+	}
+	if c.Command.Build != "" {
+		cmd, err := commandInDir(dir, c.Command.Build)
+		if err != nil {
+			return err
+		}
+		_, err = runCmd(c.runner(), cmd, c.debug())
+		if err != nil {
+			return err
+		}
+	}
+	for i := 0; i < count; i++ {
+		cmd, err := commandInDir(dir, c.Command.Run)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		result, err := c.runWrapped(cmd, side)
+		if err != nil {
+			return err
+		}
+		elapsed := time.Since(start)
+		usage := result.Usage
+		if usage == nil {
+			usage = new(ResourceUsage)
+		}
+		_, err = fmt.Fprintf(w, "%s\t1\t%d ns/op\t%d user-ns/op\t%d sys-ns/op\t%d peak-RSS-B\n",
+			commandBenchName, elapsed.Nanoseconds(), usage.UserTime.Nanoseconds(),
+			usage.SystemTime.Nanoseconds(), usage.MaxRSS)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func commandInDir(dir, cmdline string) (*Command, error) {
+	fields, err := splitCommandLine(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	cmd := NewCommand(fields[0], fields[1:]...)
+	cmd.Dir = dir
+	return cmd, nil
+}
+
+// splitCommandLine splits cmdline into arguments the way a POSIX shell does without expanding
+// anything. Single quotes keep everything literally, double quotes keep everything except
+// backslash escapes of $, `, ", \ and newline, and a backslash outside quotes escapes the next character.
+func splitCommandLine(cmdline string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	for i := 0; i < len(cmdline); i++ {
+		ch := cmdline[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case ch == '\'':
+			end := strings.IndexByte(cmdline[i+1:], '\'')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated ' in command %q", cmdline)
+			}
+			arg.WriteString(cmdline[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case ch == '"':
+			i++
+			for ; i < len(cmdline) && cmdline[i] != '"'; i++ {
+				if cmdline[i] == '\\' && i+1 < len(cmdline) && strings.IndexByte("$`\"\\\n", cmdline[i+1]) != -1 {
+					i++
+				}
+				arg.WriteByte(cmdline[i])
+			}
+			if i == len(cmdline) {
+				return nil, fmt.Errorf("unterminated \" in command %q", cmdline)
+			}
+			inArg = true
+		case ch == '\\':
+			if i+1 < len(cmdline) {
+				i++
+				arg.WriteByte(cmdline[i])
+			}
+			inArg = true
+		default:
+			arg.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_splitCommandLine(t *testing.T) {
+	for cmdline, want := range map[string][]string{
+		`./bin/app serve`:                      {"./bin/app", "serve"},
+		`  go   test -run 'A B' . `:            {"go", "test", "-run", "A B", "."},
+		`"/path with spaces/app" --name="x y"`: {"/path with spaces/app", "--name=x y"},
+		`echo "a \"b\" \$c \d" it\'s`:          {"echo", `a "b" $c \d`, "it's"},
+		`echo '' ""`:                           {"echo", "", ""},
+		`echo 'a'"b"c`:                         {"echo", "abc"},
+		``:                                     nil,
+	} {
+		got, err := splitCommandLine(cmdline)
+		require.NoError(t, err, cmdline)
+		require.Equal(t, want, got, cmdline)
+	}
+	_, err := splitCommandLine(`echo 'oops`)
+	require.EqualError(t, err, `unterminated ' in command "echo 'oops"`)
+	_, err = splitCommandLine(`echo "oops`)
+	require.Error(t, err)
+}
+
+func Test_commandInDir(t *testing.T) {
+	cmd, err := commandInDir("/tmp", `sh -c 'sleep 0.1 && echo done'`)
+	require.NoError(t, err)
+	require.Equal(t, "/tmp", cmd.Dir)
+	require.Equal(t, []string{"-c", "sleep 0.1 && echo done"}, cmd.Args)
+
+	_, err = commandInDir("/tmp", "  ")
+	require.EqualError(t, err, "empty command")
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Failure is a package or benchmark that failed on one side of the comparison
+type Failure struct {
+	Side      string `json:"side"` // SideBase or SideHead
+	Package   string `json:"package"`
+	Benchmark string `json:"benchmark,omitempty"` // empty when the whole package failed
+	Panic     bool   `json:"panic,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+func (f Failure) String() string {
+	s := f.Side + " " + f.Package
+	if f.Benchmark != "" {
+		s += " " + f.Benchmark
+	}
+	if f.Panic {
+		s += " (panic)"
+	}
+	return s
+}
+
+// BenchmarkFailuresError is returned when benchmarks fail and Benchdiff.ContinueOnFailure is not set
+type BenchmarkFailuresError struct {
+	Failures []Failure
+}
+
+func (e *BenchmarkFailuresError) Error() string {
+	var buf strings.Builder
+	buf.WriteString("benchmarks failed:")
+	for _, failure := range e.Failures {
+		fmt.Fprintf(&buf, "\n  %s\n    %s", failure, strings.ReplaceAll(failure.Reason, "\n", "\n    "))
+	}
+	return buf.String()
+}
+
+var (
+	failLineRegexp  = regexp.MustCompile(`^\s*--- FAIL: (Benchmark\S*)`)
+	panicFuncRegexp = regexp.MustCompile(`\.(Benchmark[^.(/]*)[.(]`)
+	failPkgRegexp   = regexp.MustCompile(`^FAIL\t(\S+)`)
+)
+
+// parseBenchmarkFailures finds failed and panicked benchmarks in the text output of "go test -bench".
+func parseBenchmarkFailures(output []byte, side string) []Failure {
+	var failures []Failure
+	var pkg string
+	var current *Failure // the failure whose log lines are being collected
+	var unknownPkg []int // indexes of failures seen before their package is known
+	add := func(failure Failure) {
+		failures = append(failures, failure)
+		current = &failures[len(failures)-1]
+		if failure.Package == "" {
+			unknownPkg = append(unknownPkg, len(failures)-1)
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "pkg: "):
+			pkg = strings.TrimPrefix(line, "pkg: ")
+			current = nil
+		case failLineRegexp.MatchString(line):
+			add(Failure{
+				Side:      side,
+				Package:   pkg,
+				Benchmark: failLineRegexp.FindStringSubmatch(line)[1],
+			})
+		case strings.HasPrefix(line, "panic: "):
+			add(Failure{
+				Side:    side,
+				Package: pkg,
+				Panic:   true,
+				Reason:  line,
+			})
+		case failPkgRegexp.MatchString(line):
+			failPkg := failPkgRegexp.FindStringSubmatch(line)[1]
+			for _, i := range unknownPkg {
+				failures[i].Package = failPkg
+			}
+			unknownPkg = nil
+			pkg = ""
+			current = nil
+		case current == nil:
+		case current.Panic:
+			// the first benchmark function in the stack trace is the one that panicked
+			if current.Benchmark == "" {
+				if m := panicFuncRegexp.FindStringSubmatch(line); m != nil {
+					current.Benchmark = m[1]
+				}
+			}
+		case strings.HasPrefix(line, "    "):
+			current.Reason = strings.TrimPrefix(current.Reason+"\n"+strings.TrimSpace(line), "\n")
+		default:
+			current = nil
+		}
+	}
+	return failures
+}
+
+// checkBenchmarkFailures decides what to do with failures found in the output of a benchmark
+// command that exited with runErr. When tolerate is true, the failures are returned instead of an error.
+func (c *Benchdiff) checkBenchmarkFailures(failures []Failure, result *CommandResult, runErr error, tolerate bool) ([]Failure, error) {
+	if runErr == nil || result == nil {
+		return nil, runErr
+	}
+	if len(failures) == 0 {
+		return nil, runErr
+	}
+	if !tolerate {
+		return nil, &BenchmarkFailuresError{Failures: failures}
+	}
+	c.debug().Printf("continuing after benchmark failures: %v", runErr)
+	return failures, nil
+}
+
+// failuresFilename returns the file where package failures for the benchmark output in filename are kept.
+func failuresFilename(filename string) string {
+	return strings.TrimSuffix(filename, ".out") + ".failures.json"
+}
+
+func writeFailuresFile(filename string, failures []Failure) error {
+	if len(failures) == 0 {
+		err := os.Remove(filename)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o666)
+}
+
+func readFailuresFile(filename string) ([]Failure, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var failures []Failure
+	err = json.Unmarshal(data, &failures)
+	if err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseBenchmarkFailures(t *testing.T) {
+	output := `goos: linux
+goarch: amd64
+pkg: x/a
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkGood  	      10	        26.00 ns/op
+--- FAIL: BenchmarkBad
+    a_test.go:11: some log
+    a_test.go:12: boom
+BenchmarkGood2 	      10	        11.60 ns/op
+panic: oh no
+
+goroutine 17 [running]:
+x/a.BenchmarkPanic.func1(0x2dcdf1a24908?)
+	/tmp/lt/a/a_test.go:21 +0x25
+testing.(*B).runN(0x2dcdf1a24908, 0x1)
+	/usr/local/go/src/testing/benchmark.go:219 +0x190
+exit status 2
+FAIL	x/a	0.008s
+panic: boom [recovered]
+
+goroutine 5 [running]:
+x/b.BenchmarkB(0x2dcdf1a24908?)
+	/tmp/lt/b/b_test.go:21 +0x25
+exit status 2
+FAIL	x/b	0.008s
+FAIL
+`
+	got := parseBenchmarkFailures([]byte(output), SideHead)
+	require.Equal(t, []Failure{
+		{
+			Side:      SideHead,
+			Package:   "x/a",
+			Benchmark: "BenchmarkBad",
+			Reason:    "a_test.go:11: some log\na_test.go:12: boom",
+		},
+		{
+			Side:      SideHead,
+			Package:   "x/a",
+			Benchmark: "BenchmarkPanic",
+			Panic:     true,
+			Reason:    "panic: oh no",
+		},
+		{
+			Side:      SideHead,
+			Package:   "x/b",
+			Benchmark: "BenchmarkB",
+			Panic:     true,
+			Reason:    "panic: boom [recovered]",
+		},
+	}, got)
+}
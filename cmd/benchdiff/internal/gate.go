@@ -0,0 +1,375 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Gate is a named pass/fail policy. Its expression is evaluated for every row from RunResult.Rows
+// and RunResult.SummaryRows, and the gate fails when it is true for any of them.
+//
+// Expressions use Go syntax. They can use these fields of the row:
+//
+//	name    string  the benchmark name without the GOMAXPROCS suffix like "BenchmarkParse/small" or "geomean"
+//	pkg     string  the package from the benchstat group
+//	group   string  the benchstat group
+//	metric  string  the benchstat table like "time/op" or "allocs/op"
+//	unit    string  the unit of old and new like "ns/op"
+//	old     number  the base mean
+//	new     number  the head mean
+//	delta   number  new - old
+//	pct     number  the percent change. 0 unless it is significant, except for summary rows
+//	p       number  the p-value of the delta test
+//	change  string  "degraded", "improved" or "insignificant"
+//	summary bool    true for the geomean of each metric
+//
+// The functions abs(number) and matches(string, "regexp") are available.
+type Gate struct {
+	Name       string
+	ExitCode   int
+	Expression string
+	eval       func(gateRow) interface{}
+}
+
+// gateRow is the value of each field for one row
+type gateRow map[string]interface{}
+
+type gateType string
+
+const (
+	gateBool   gateType = "bool"
+	gateNumber gateType = "number"
+	gateString gateType = "string"
+)
+
+var gateFields = map[string]gateType{
+	"name":    gateString,
+	"pkg":     gateString,
+	"group":   gateString,
+	"metric":  gateString,
+	"unit":    gateString,
+	"old":     gateNumber,
+	"new":     gateNumber,
+	"delta":   gateNumber,
+	"pct":     gateNumber,
+	"p":       gateNumber,
+	"change":  gateString,
+	"summary": gateBool,
+}
+
+// ParseGate parses a Gate from a string in the form "name[=exitcode]: expression". The exit code
+// defaults to 1.
+func ParseGate(s string) (*Gate, error) {
+	head, expression, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid gate %q: expected the form name[=exitcode]: expression", s)
+	}
+	gate := &Gate{
+		Name:       strings.TrimSpace(head),
+		ExitCode:   1,
+		Expression: strings.TrimSpace(expression),
+	}
+	if name, code, ok := strings.Cut(gate.Name, "="); ok {
+		var err error
+		gate.Name = strings.TrimSpace(name)
+		gate.ExitCode, err = strconv.Atoi(strings.TrimSpace(code))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gate %q: exit code must be an integer", s)
+		}
+	}
+	if gate.Name == "" {
+		return nil, fmt.Errorf("invalid gate %q: missing name", s)
+	}
+	expr, err := parser.ParseExpr(gate.Expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gate %q: %v", s, err)
+	}
+	typ, eval, err := compileGateExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gate %q: %v", s, err)
+	}
+	if typ != gateBool {
+		return nil, fmt.Errorf("invalid gate %q: expression is a %s, not a bool", s, typ)
+	}
+	gate.eval = eval
+	return gate, nil
+}
+
+// compileGateExpr type checks expr and returns its type and a function that evaluates it
+func compileGateExpr(expr ast.Expr) (gateType, func(gateRow) interface{}, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return compileGateExpr(e.X)
+	case *ast.BasicLit:
+		return compileGateLiteral(e)
+	case *ast.Ident:
+		switch e.Name {
+		case "true", "false":
+			value := e.Name == "true"
+			return gateBool, func(gateRow) interface{} { return value }, nil
+		}
+		typ, ok := gateFields[e.Name]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown field %q", e.Name)
+		}
+		name := e.Name
+		return typ, func(row gateRow) interface{} { return row[name] }, nil
+	case *ast.UnaryExpr:
+		typ, eval, err := compileGateExpr(e.X)
+		if err != nil {
+			return "", nil, err
+		}
+		switch {
+		case e.Op == token.NOT && typ == gateBool:
+			return gateBool, func(row gateRow) interface{} { return !eval(row).(bool) }, nil
+		case e.Op == token.SUB && typ == gateNumber:
+			return gateNumber, func(row gateRow) interface{} { return -eval(row).(float64) }, nil
+		}
+		return "", nil, fmt.Errorf("operator %s is not defined on %s", e.Op, typ)
+	case *ast.BinaryExpr:
+		return compileGateBinary(e)
+	case *ast.CallExpr:
+		return compileGateCall(e)
+	}
+	return "", nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+func compileGateLiteral(lit *ast.BasicLit) (gateType, func(gateRow) interface{}, error) {
+	switch lit.Kind {
+	case token.INT, token.FLOAT:
+		value, err := strconv.ParseFloat(lit.Value, 64)
+		if err != nil {
+			return "", nil, err
+		}
+		return gateNumber, func(gateRow) interface{} { return value }, nil
+	case token.STRING:
+		value, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		return gateString, func(gateRow) interface{} { return value }, nil
+	}
+	return "", nil, fmt.Errorf("unsupported literal %s", lit.Value)
+}
+
+func compileGateBinary(e *ast.BinaryExpr) (gateType, func(gateRow) interface{}, error) {
+	xType, x, err := compileGateExpr(e.X)
+	if err != nil {
+		return "", nil, err
+	}
+	yType, y, err := compileGateExpr(e.Y)
+	if err != nil {
+		return "", nil, err
+	}
+	if xType != yType {
+		return "", nil, fmt.Errorf("mismatched types %s and %s for %s", xType, yType, e.Op)
+	}
+	switch e.Op {
+	case token.LAND, token.LOR:
+		if xType != gateBool {
+			return "", nil, fmt.Errorf("operator %s is not defined on %s", e.Op, xType)
+		}
+		if e.Op == token.LAND {
+			return gateBool, func(row gateRow) interface{} { return x(row).(bool) && y(row).(bool) }, nil
+		}
+		return gateBool, func(row gateRow) interface{} { return x(row).(bool) || y(row).(bool) }, nil
+	case token.EQL:
+		return gateBool, func(row gateRow) interface{} { return x(row) == y(row) }, nil
+	case token.NEQ:
+		return gateBool, func(row gateRow) interface{} { return x(row) != y(row) }, nil
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if xType == gateBool {
+			return "", nil, fmt.Errorf("operator %s is not defined on %s", e.Op, xType)
+		}
+		op := e.Op
+		return gateBool, func(row gateRow) interface{} { return gateCompare(op, x(row), y(row)) }, nil
+	case token.ADD, token.SUB, token.MUL, token.QUO:
+		if xType != gateNumber {
+			return "", nil, fmt.Errorf("operator %s is not defined on %s", e.Op, xType)
+		}
+		op := e.Op
+		return gateNumber, func(row gateRow) interface{} {
+			a, b := x(row).(float64), y(row).(float64)
+			switch op {
+			case token.ADD:
+				return a + b
+			case token.SUB:
+				return a - b
+			case token.MUL:
+				return a * b
+			default:
+				return a / b
+			}
+		}, nil
+	}
+	return "", nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+// gateCompare compares two numbers or two strings
+func gateCompare(op token.Token, x, y interface{}) bool {
+	cmp := 0
+	switch x := x.(type) {
+	case float64:
+		y := y.(float64)
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case string:
+		cmp = strings.Compare(x, y.(string))
+	}
+	switch op {
+	case token.LSS:
+		return cmp < 0
+	case token.LEQ:
+		return cmp <= 0
+	case token.GTR:
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func compileGateCall(e *ast.CallExpr) (gateType, func(gateRow) interface{}, error) {
+	fn, ok := e.Fun.(*ast.Ident)
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported function call")
+	}
+	switch fn.Name {
+	case "abs":
+		if len(e.Args) != 1 {
+			return "", nil, fmt.Errorf("abs takes 1 argument")
+		}
+		typ, x, err := compileGateExpr(e.Args[0])
+		if err != nil {
+			return "", nil, err
+		}
+		if typ != gateNumber {
+			return "", nil, fmt.Errorf("abs takes a number, not a %s", typ)
+		}
+		return gateNumber, func(row gateRow) interface{} { return math.Abs(x(row).(float64)) }, nil
+	case "matches":
+		if len(e.Args) != 2 {
+			return "", nil, fmt.Errorf("matches takes 2 arguments")
+		}
+		typ, x, err := compileGateExpr(e.Args[0])
+		if err != nil {
+			return "", nil, err
+		}
+		if typ != gateString {
+			return "", nil, fmt.Errorf("matches takes a string, not a %s", typ)
+		}
+		lit, ok := e.Args[1].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return "", nil, fmt.Errorf("the second argument to matches must be a string literal")
+		}
+		pattern, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", nil, err
+		}
+		return gateBool, func(row gateRow) interface{} { return re.MatchString(x(row).(string)) }, nil
+	}
+	return "", nil, fmt.Errorf("unknown function %q", fn.Name)
+}
+
+// newGateRow returns the fields of row for gate expressions. procs are the GOMAXPROCS values the
+// benchmarks ran with.
+func newGateRow(row *ComparedRow, summary bool, procs []int) gateRow {
+	name := ruleBenchmarkName(row.Benchmark, procs)
+	if summary {
+		name = "geomean"
+	}
+	change := "insignificant"
+	switch row.Change {
+	case DegradingChange:
+		change = "degraded"
+	case ImprovingChange:
+		change = "improved"
+	}
+	return gateRow{
+		"name":    name,
+		"pkg":     row.Package,
+		"group":   row.Group,
+		"metric":  row.Metric,
+		"unit":    row.Unit,
+		"old":     row.Old,
+		"new":     row.New,
+		"delta":   row.Delta(),
+		"pct":     row.PctDelta,
+		"p":       row.P,
+		"change":  change,
+		"summary": summary,
+	}
+}
+
+// GateResult is a Gate that failed and the rows that failed it
+type GateResult struct {
+	Name       string   `json:"name"`
+	ExitCode   int      `json:"exit_code"`
+	Expression string   `json:"expression"`
+	Matches    []string `json:"matches"`
+}
+
+// CheckGates returns the gates that fail in the order they are given
+func (r *RunResult) CheckGates(gates []*Gate) []GateResult {
+	var results []GateResult
+	rows := r.Rows()
+	summaries := r.SummaryRows()
+	for _, gate := range gates {
+		result := GateResult{
+			Name:       gate.Name,
+			ExitCode:   gate.ExitCode,
+			Expression: gate.Expression,
+		}
+		for i := range rows {
+			if gate.eval(newGateRow(&rows[i], false, r.procs)).(bool) {
+				result.Matches = append(result.Matches, gateMatchString(&rows[i]))
+			}
+		}
+		for i := range summaries {
+			if gate.eval(newGateRow(&summaries[i], true, r.procs)).(bool) {
+				result.Matches = append(result.Matches, gateMatchString(&summaries[i]))
+			}
+		}
+		if len(result.Matches) > 0 {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func gateMatchString(row *ComparedRow) string {
+	s := fmt.Sprintf("%s %s %s -> %s %s (%+.2f%%)", row.Benchmark, row.Metric, formatMean(row.Old), formatMean(row.New), row.Unit, row.PctDelta)
+	if row.Group == "" {
+		return s
+	}
+	return row.Group + " " + s
+}
+
+// formatMean formats a mean with up to two decimal places
+func formatMean(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// GateExitCode returns the exit code of the first failed gate with a non-zero exit code
+func GateExitCode(results []GateResult) int {
+	for _, result := range results {
+		if result.ExitCode != 0 {
+			return result.ExitCode
+		}
+	}
+	return 0
+}
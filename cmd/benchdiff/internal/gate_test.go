@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/perf/benchstat"
+)
+
+func TestParseGate(t *testing.T) {
+	gate, err := ParseGate(`codec-allocs=3: pkg == "example.com/codec" && metric == "allocs/op" && new > old`)
+	require.NoError(t, err)
+	require.Equal(t, "codec-allocs", gate.Name)
+	require.Equal(t, 3, gate.ExitCode)
+	require.Equal(t, `pkg == "example.com/codec" && metric == "allocs/op" && new > old`, gate.Expression)
+
+	gate, err = ParseGate(`slow: pct > 5`)
+	require.NoError(t, err)
+	require.Equal(t, "slow", gate.Name)
+	require.Equal(t, 1, gate.ExitCode)
+
+	for s, want := range map[string]string{
+		`pct > 5`:                  `invalid gate "pct > 5": expected the form name[=exitcode]: expression`,
+		`: pct > 5`:                `invalid gate ": pct > 5": missing name`,
+		`x=y: pct > 5`:             `invalid gate "x=y: pct > 5": exit code must be an integer`,
+		`x: pct`:                   `invalid gate "x: pct": expression is a number, not a bool`,
+		`x: speed > 5`:             `invalid gate "x: speed > 5": unknown field "speed"`,
+		`x: name > 5`:              `invalid gate "x: name > 5": mismatched types string and number for >`,
+		`x: summary < true`:        `invalid gate "x: summary < true": operator < is not defined on bool`,
+		`x: -name == ""`:           `invalid gate "x: -name == \"\"": operator - is not defined on string`,
+		`x: matches(name, metric)`: `invalid gate "x: matches(name, metric)": the second argument to matches must be a string literal`,
+		`x: max(pct) > 1`:          `invalid gate "x: max(pct) > 1": unknown function "max"`,
+	} {
+		_, err = ParseGate(s)
+		require.EqualError(t, err, want, s)
+	}
+	_, err = ParseGate(`x: pct >`)
+	require.Error(t, err)
+}
+
+func TestGate_eval(t *testing.T) {
+	row := newGateRow(&ComparedRow{
+		Group:     "pkg:example.com/codec goos:linux",
+		Package:   "example.com/codec",
+		Benchmark: "Decode/small-8",
+		Metric:    "time/op",
+		Unit:      "ns/op",
+		Old:       100,
+		New:       150,
+		PctDelta:  50,
+		P:         0.008,
+		Change:    DegradingChange,
+	}, false, []int{8})
+	for expression, want := range map[string]bool{
+		`name == "BenchmarkDecode/small"`:          true,
+		`matches(name, "^BenchmarkDecode/")`:       true,
+		`matches(pkg, "/other$")`:                  false,
+		`delta == 50 && new - old == delta`:        true,
+		`pct > 3 && p < 0.05`:                      true,
+		`change == "degraded" && !summary`:         true,
+		`abs(-pct) / 2 == 25`:                      true,
+		`(unit != "ns/op" || metric <= "time/op")`: true,
+		`group >= "pkg:z" || false`:                false,
+	} {
+		gate, err := ParseGate("g: " + expression)
+		require.NoError(t, err, expression)
+		require.Equal(t, want, gate.eval(row), expression)
+	}
+}
+
+func TestRunResult_CheckGates(t *testing.T) {
+	result := &RunResult{
+		tables: []*benchstat.Table{
+			{
+				Metric: "time/op",
+				Groups: []string{"pkg:example.com/codec"},
+				Rows: []*benchstat.Row{
+					testRow("Decode-8", 2, InsignificantChange),
+					testRow("Encode-8", 3, InsignificantChange),
+				},
+			},
+			{
+				Metric: "allocs/op",
+				Groups: []string{"pkg:example.com/codec"},
+				Rows: []*benchstat.Row{
+					testRow("Decode-8", 1, DegradingChange),
+				},
+			},
+		},
+	}
+	var gates []*Gate
+	for _, s := range []string{
+		`geomean=2: summary && metric == "time/op" && pct > 2`,
+		`codec-allocs=3: pkg == "example.com/codec" && metric == "allocs/op" && new > old`,
+		`huge: pct > 50`,
+	} {
+		gate, err := ParseGate(s)
+		require.NoError(t, err)
+		gates = append(gates, gate)
+	}
+	results := result.CheckGates(gates)
+	require.Equal(t, []GateResult{
+		{
+			Name:       "geomean",
+			ExitCode:   2,
+			Expression: `summary && metric == "time/op" && pct > 2`,
+			Matches:    []string{"[Geo mean] time/op 100 -> 102.5 ns/op (+2.50%)"},
+		},
+		{
+			Name:       "codec-allocs",
+			ExitCode:   3,
+			Expression: `pkg == "example.com/codec" && metric == "allocs/op" && new > old`,
+			Matches:    []string{"Decode-8 allocs/op 100 -> 101 ns/op (+1.00%)"},
+		},
+	}, results)
+	require.Equal(t, 2, GateExitCode(results))
+	require.Equal(t, 0, GateExitCode(nil))
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// GeomeanResult is the verdict for the geometric mean of one metric
+type GeomeanResult struct {
+	ComparedRow
+	Tolerance float64 `json:"tolerance"`
+	Degraded  bool    `json:"degraded"`
+}
+
+func (g GeomeanResult) String() string {
+	return fmt.Sprintf("%s %+.2f%%", g.Metric, g.PctDelta)
+}
+
+// ParseGeomeanTolerance parses the geomean tolerance for one metric from a string in the form
+// "metric=tolerance".
+func ParseGeomeanTolerance(s string) (string, float64, error) {
+	metric, value, err := parseMetricOption(s)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid geomean tolerance %q: %v", s, err)
+	}
+	tolerance, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid geomean tolerance %q: tolerance must be a number", s)
+	}
+	return metric, tolerance, nil
+}
+
+// GeomeanResults compares the geomean of each metric in tolerances with its tolerance. A geomean
+// is degraded when it gets worse by more than the tolerance whether or not any row is significant.
+func (r *RunResult) GeomeanResults(tolerances map[string]float64) []GeomeanResult {
+	var results []GeomeanResult
+	for _, row := range r.SummaryRows() {
+		tolerance, ok := tolerances[row.Metric]
+		if !ok {
+			continue
+		}
+		worse := row.PctDelta
+		if row.Metric == "speed" {
+			// higher is better
+			worse = -worse
+		}
+		results = append(results, GeomeanResult{
+			ComparedRow: row,
+			Tolerance:   tolerance,
+			Degraded:    worse > tolerance,
+		})
+	}
+	return results
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/perf/benchstat"
+)
+
+func TestParseGeomeanTolerance(t *testing.T) {
+	metric, tolerance, err := ParseGeomeanTolerance(`ns/op=3`)
+	require.NoError(t, err)
+	require.Equal(t, "time/op", metric)
+	require.Equal(t, 3.0, tolerance)
+
+	_, _, err = ParseGeomeanTolerance(`ns/op=x`)
+	require.EqualError(t, err, `invalid geomean tolerance "ns/op=x": tolerance must be a number`)
+}
+
+func TestRunResult_GeomeanResults(t *testing.T) {
+	speedRow := func(benchmark string, oldMean, newMean float64) *benchstat.Row {
+		return &benchstat.Row{
+			Benchmark: benchmark,
+			Metrics: []*benchstat.Metrics{
+				{Unit: "MB/s", Mean: oldMean},
+				{Unit: "MB/s", Mean: newMean},
+			},
+		}
+	}
+	result := &RunResult{
+		tables: []*benchstat.Table{
+			{
+				Metric: "time/op",
+				Rows: []*benchstat.Row{
+					testRow("A-8", 3, InsignificantChange),
+					testRow("B-8", 3, InsignificantChange),
+				},
+			},
+			{
+				Metric: "speed",
+				Rows: []*benchstat.Row{
+					speedRow("A-8", 100, 110),
+					speedRow("B-8", 100, 110),
+				},
+			},
+			{
+				Metric: "alloc/op",
+				Rows: []*benchstat.Row{
+					testRow("A-8", 50, InsignificantChange),
+				},
+			},
+		},
+	}
+	results := result.GeomeanResults(map[string]float64{"time/op": 2, "speed": 5})
+	require.Len(t, results, 2)
+	require.Equal(t, "time/op", results[0].Metric)
+	require.InDelta(t, 3, results[0].PctDelta, 0.0001)
+	require.True(t, results[0].Degraded)
+	require.Equal(t, "speed", results[1].Metric)
+	require.InDelta(t, 10, results[1].PctDelta, 0.0001)
+	require.False(t, results[1].Degraded)
+
+	require.Empty(t, result.DegradedRows(&DegradeOptions{Tolerance: 10}))
+	degraded := result.DegradedRows(&DegradeOptions{
+		Tolerance:         10,
+		GeomeanTolerances: map[string]float64{"time/op": 2, "speed": 5},
+	})
+	require.Len(t, degraded, 1)
+	require.Equal(t, geomeanBenchmark, degraded[0].Benchmark)
+	require.Equal(t, 2.0, degraded[0].Tolerance)
+	require.Equal(t, []sectionItem{
+		{title: "[Geo mean] time/op +3.00%", detail: "over the geomean tolerance of 2%"},
+	}, degradedRowItems(degraded))
+
+	// lower speeds are worse
+	result.tables[1].Rows = []*benchstat.Row{speedRow("A-8", 110, 100)}
+	results = result.GeomeanResults(map[string]float64{"speed": 5})
+	require.InDelta(t, -9.0909, results[0].PctDelta, 0.0001)
+	require.True(t, results[0].Degraded)
+}
@@ -5,19 +5,18 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 )
 
-func runGitCmd(debug *log.Logger, gitCmd, repoPath string, args ...string) ([]byte, error) {
+func runGitCmd(runner Runner, debug *log.Logger, gitCmd, repoPath string, args ...string) ([]byte, error) {
 	var stdout bytes.Buffer
-	cmd := exec.Command(gitCmd, args...)
+	cmd := NewCommand(gitCmd, args...)
 	cmd.Stdout = &stdout
 	cmd.Dir = repoPath
-	err := runCmd(cmd, debug)
+	_, err := runCmd(runner, cmd, debug)
 	return bytes.TrimSpace(stdout.Bytes()), err
 }
 
-func runAtGitRef(debug *log.Logger, gitCmd, repoPath, ref string, fn func(path string)) error {
+func runAtGitRef(runner Runner, debug *log.Logger, gitCmd, repoPath, ref string, fn func(path string)) error {
 	worktree, err := os.MkdirTemp("", "benchdiff")
 	if err != nil {
 		return err
@@ -29,17 +28,14 @@ func runAtGitRef(debug *log.Logger, gitCmd, repoPath, ref string, fn func(path s
 		}
 	}()
 
-	_, err = runGitCmd(debug, gitCmd, repoPath, "worktree", "add", "--quiet", "--detach", worktree, ref)
+	_, err = runGitCmd(runner, debug, gitCmd, repoPath, "worktree", "add", "--quiet", "--detach", worktree, ref)
 	if err != nil {
 		return err
 	}
 
 	defer func() {
-		_, cerr := runGitCmd(debug, gitCmd, repoPath, "worktree", "remove", worktree)
+		_, cerr := runGitCmd(runner, debug, gitCmd, repoPath, "worktree", "remove", worktree)
 		if cerr != nil {
-			if exitErr, ok := cerr.(*exec.ExitError); ok {
-				fmt.Println(string(exitErr.Stderr))
-			}
 			fmt.Println(cerr)
 		}
 	}()
@@ -30,7 +30,7 @@ func Test_runAtGitRef(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, "OG content", string(got))
 	}
-	err = runAtGitRef(nil, "git", dir, "HEAD", fn)
+	err = runAtGitRef(nil, nil, "git", dir, "HEAD", fn)
 	require.NoError(t, err)
 	got, err := os.ReadFile(fooPath)
 	require.NoError(t, err)
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const processBenchName = "BenchmarkGoTestProcess"
+
+// perPackage returns true when benchmarks need to run in a separate process for each package.
+func (c *Benchdiff) perPackage() bool {
+	return c.ResourceUsage || c.AllowPartial
+}
+
+// listedPackage is the subset of "go list -json" output that benchdiff uses
+type listedPackage struct {
+	ImportPath   string
+	Name         string
+	Dir          string
+	Deps         []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	TestImports  []string
+	XTestImports []string
+	DepOnly      bool   // only listed because a listed package or its tests depend on it
+	ForTest      string // set on the variants of packages built for a package's tests
+	Error        *struct {
+		Err string
+	}
+}
+
+// listPackages returns the packages matching c.Packages using cmd's go executable, directory and
+// environment. flags are added to the go list command. Packages that can't be loaded are returned
+// with Error set.
+func (c *Benchdiff) listPackages(cmd *Command, flags ...string) ([]listedPackage, error) {
+	var stdout bytes.Buffer
+	args := append(append([]string{"list", "-e", "-json"}, flags...), c.Packages...)
+	listCmd := NewCommand(cmd.Path, args...)
+	listCmd.Dir = cmd.Dir
+	listCmd.Env = cmd.Env
+	listCmd.Stdout = &stdout
+	_, err := runCmd(c.runner(), listCmd, c.debug())
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []listedPackage
+	decoder := json.NewDecoder(&stdout)
+	for {
+		var pkg listedPackage
+		err = decoder.Decode(&pkg)
+		if errors.Is(err, io.EOF) {
+			return pkgs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+}
+
+// runPackages runs benchmarks for each package matched by c.Packages in its own process. It uses
+// cmd's go executable, directory and environment. When c.AllowPartial is set, packages that fail
+// to load, build or run are returned as failures instead of errors. Logs from go test -json are
+// written to logDir.
+func (c *Benchdiff) runPackages(cmd *Command, side *WrapperData, logDir string) ([]Failure, error) {
+	if c.PackageBenchArgs == nil {
+		return nil, fmt.Errorf("PackageBenchArgs is required to run packages separately")
+	}
+	stdout := cmd.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	pkgs, err := c.listPackages(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var failures []Failure
+	for _, listed := range pkgs {
+		pkg := listed.ImportPath
+		if listed.Error != nil {
+			if !c.AllowPartial {
+				return nil, fmt.Errorf("error loading package %s: %s", pkg, listed.Error.Err)
+			}
+			failures = append(failures, Failure{
+				Side:    side.Side,
+				Package: pkg,
+				Reason:  listed.Error.Err,
+			})
+			continue
+		}
+		var args string
+		args, err = c.PackageBenchArgs(pkg)
+		if err != nil {
+			return nil, err
+		}
+		args = c.addBenchArgs(args, side.warmup())
+		var output bytes.Buffer
+		var pkgErr bytes.Buffer
+		var result *CommandResult
+		var runErr error
+		var usages []*ResourceUsage
+		if c.ResourceUsage {
+			usages, result, runErr = c.runTestBinary(cmd, &listed, args, side, c.progressWriter(&output), &pkgErr)
+		} else {
+			pkgCmd := NewCommand(cmd.Path, strings.Fields(args)...)
+			pkgCmd.Dir = cmd.Dir
+			pkgCmd.Env = cmd.Env
+			pkgCmd.Stdout = c.progressWriter(&output)
+			pkgCmd.Stderr = &pkgErr
+			result, runErr = c.runWrapped(pkgCmd, side)
+		}
+		var pkgOut bytes.Buffer
+		var benchFailures []Failure
+		benchFailures, err = c.benchOutput(output.Bytes(), &pkgOut, side.Side, logDir)
+		if err != nil {
+			return nil, err
+		}
+		benchFailures, err = c.checkBenchmarkFailures(benchFailures, result, runErr, c.ContinueOnFailure || c.AllowPartial)
+		for _, failure := range benchFailures {
+			if failure.Package == "" {
+				failure.Package = pkg
+			}
+			failures = append(failures, failure)
+		}
+		if err != nil {
+			if !c.AllowPartial || result == nil {
+				return nil, err
+			}
+			failures = append(failures, Failure{
+				Side:    side.Side,
+				Package: pkg,
+				Reason:  failureReason(result.ExitCode, pkgErr.String()),
+			})
+		}
+		if hasBenchmarkLines(pkgOut.Bytes()) {
+			for _, usage := range usages {
+				writeProcessUsage(&pkgOut, pkg, usage)
+			}
+		}
+		_, err = stdout.Write(pkgOut.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return failures, nil
+}
+
+func failureReason(exitCode int, stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return fmt.Sprintf("exit code %d", exitCode)
+	}
+	return stderr
+}
+
+// writeProcessUsage writes usage as a benchmark result for pkg. Each run of a test binary is one
+// sample.
+func writeProcessUsage(w *bytes.Buffer, pkg string, usage *ResourceUsage) {
+	fmt.Fprintf(w, "pkg: %s\n%s\t1\t%d peak-RSS-B\t%d user-ns\t%d sys-ns\t%d vol-ctxsw\t%d invol-ctxsw\n",
+		pkg, processBenchName, usage.MaxRSS, usage.UserTime.Nanoseconds(), usage.SystemTime.Nanoseconds(),
+		usage.VolCtxSwitches, usage.InvolCtxSwitches)
+}
+
+func hasBenchmarkLines(output []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if bytes.HasPrefix(scanner.Bytes(), []byte("Benchmark")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,469 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PlanOptions configures Benchdiff.Plan
+type PlanOptions struct {
+	Bench     string // the regexp passed to -bench. default: "."
+	Benchtime string // the value passed to -benchtime. default: "1s"
+	Tags      string // the value passed to -tags
+	CPU       []int  // the values passed to -cpu. Each benchmark runs once for each value.
+}
+
+// PlannedBenchmark is a benchmark that Benchdiff.Run would run
+type PlannedBenchmark struct {
+	Package   string `json:"package"`
+	Benchmark string `json:"benchmark"`
+	Base      bool   `json:"base"` // the benchmark exists in the base ref
+	Head      bool   `json:"head"` // the benchmark exists in the worktree
+}
+
+// SideEstimate is how long one step of Benchdiff.Run is expected to take
+type SideEstimate struct {
+	Side     string        `json:"side"` // SideWarmup, SideBase or SideHead
+	Duration time.Duration `json:"duration_ns"`
+	Source   string        `json:"source"` // one of the EstimateFrom constants
+}
+
+// Sources of a SideEstimate
+const (
+	EstimateFromHistory   = "history"   // how long the side took the last time it ran
+	EstimateFromBenchtime = "benchtime" // the number of benchmarks, count and benchtime
+	EstimateFromCache     = "cache"     // the side's results are cached and it won't run
+	EstimateUnknown       = "unknown"   // benchtime is an iteration count and there is no history
+)
+
+// Plan is what Benchdiff.Run would do
+type Plan struct {
+	BenchCmd   string             `json:"bench_command"`
+	BaseSHA    string             `json:"base_sha"`
+	Benchmarks []PlannedBenchmark `json:"benchmarks"`
+	Estimates  []SideEstimate     `json:"estimates"`
+	Cooldown   time.Duration      `json:"cooldown_ns"`
+
+	// Failures are packages go test -list couldn't load or build on one side. Their benchmarks on
+	// the other side are listed as only existing there.
+	Failures []Failure `json:"failures,omitempty"`
+
+	// SelectedPackages are the packages chosen with SelectChanged
+	SelectedPackages []SelectedPackage `json:"selected_packages,omitempty"`
+}
+
+// Plan lists the benchmarks matching opts.Bench in c.Packages on both sides with "go test -list" and
+// estimates how long Run will take without running any benchmarks. With SelectChanged and Shard,
+// only the packages Run would choose are listed.
+func (c *Benchdiff) Plan(opts *PlanOptions) (*Plan, error) {
+	if c.BuildTime != nil || c.Command != nil {
+		return nil, fmt.Errorf("plans are only available when running go benchmarks")
+	}
+	if opts == nil {
+		opts = &PlanOptions{}
+	}
+	baseSHA, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "rev-parse", c.BaseRef)
+	if err != nil {
+		return nil, err
+	}
+	planner, selected, err := c.planPackages()
+	if err != nil {
+		return nil, err
+	}
+	if planner == nil {
+		// Run won't benchmark anything
+		return &Plan{
+			BaseSHA:          string(baseSHA),
+			SelectedPackages: selected,
+		}, nil
+	}
+	plan, err := planner.plan(opts, string(baseSHA))
+	if err != nil {
+		return nil, err
+	}
+	plan.SelectedPackages = selected
+	return plan, nil
+}
+
+// planPackages returns a copy of c that benchmarks the packages Run would choose with
+// SelectChanged and Shard and the packages SelectChanged chose. The copy is nil when there are
+// no packages to benchmark.
+func (c *Benchdiff) planPackages() (*Benchdiff, []SelectedPackage, error) {
+	planner := *c
+	if !c.SelectChanged && c.Shard == nil {
+		return &planner, nil, nil
+	}
+	if c.PackageBenchArgs == nil {
+		return nil, nil, fmt.Errorf("PackageBenchArgs is required to select packages")
+	}
+	var selected []SelectedPackage
+	if c.SelectChanged {
+		var err error
+		selected, err = c.selectChangedPackages()
+		if err != nil {
+			return nil, nil, err
+		}
+		planner.SelectChanged = false
+		planner.Packages = make([]string, len(selected))
+		for i, s := range selected {
+			planner.Packages[i] = s.Package
+		}
+	}
+	if c.Shard != nil && len(planner.Packages) > 0 {
+		pkgs, _, err := planner.shardPackages()
+		if err != nil {
+			return nil, nil, err
+		}
+		planner.Shard = nil
+		planner.Packages = pkgs
+	}
+	if len(planner.Packages) == 0 {
+		return nil, selected, nil
+	}
+	var err error
+	planner.BenchArgs, err = c.PackageBenchArgs(strings.Join(planner.Packages, " "))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &planner, selected, nil
+}
+
+// plan lists the benchmarks in c.Packages and estimates how long Run will take
+func (c *Benchdiff) plan(opts *PlanOptions, baseSHA string) (*Plan, error) {
+	plan := &Plan{
+		BenchCmd: c.benchCmdline(),
+		BaseSHA:  baseSHA,
+	}
+
+	var baseBenchmarks []PlannedBenchmark
+	var baseFailures []Failure
+	var listErr error
+	err := runAtGitRef(c.runner(), c.debug(), c.gitCmd(), c.Path, c.BaseRef, func(workPath string) {
+		baseBenchmarks, baseFailures, listErr = c.listBenchmarks(workPath, SideBase, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if listErr != nil {
+		return nil, listErr
+	}
+	headBenchmarks, headFailures, err := c.listBenchmarks(c.Path, SideHead, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan.Benchmarks = mergePlannedBenchmarks(baseBenchmarks, headBenchmarks)
+	plan.Failures = append(baseFailures, headFailures...)
+
+	timings := readTimings(c.timingsFilename())
+	runsPerSample := 1
+	if len(opts.CPU) > 0 {
+		runsPerSample = len(opts.CPU)
+	}
+	estimate := func(side string, benchmarks, count int, benchtime string) SideEstimate {
+		est := SideEstimate{
+			Side:     side,
+			Duration: timings[c.timingKey(side)],
+			Source:   EstimateFromHistory,
+		}
+		if est.Duration > 0 {
+			return est
+		}
+		perSample, ok := benchtimeDuration(benchtime)
+		if !ok {
+			est.Source = EstimateUnknown
+			return est
+		}
+		est.Source = EstimateFromBenchtime
+		est.Duration = time.Duration(benchmarks*count*runsPerSample) * perSample
+		return est
+	}
+	var baseCount, headCount int
+	for _, b := range plan.Benchmarks {
+		if b.Base {
+			baseCount++
+		}
+		if b.Head {
+			headCount++
+		}
+	}
+	baseCached := !c.Force && fileExists(c.baseOutputFilename(plan.BaseSHA))
+	if c.WarmupCount > 0 && !baseCached {
+		warmupTime := opts.Benchtime
+		if c.WarmupTime != "" {
+			warmupTime = c.WarmupTime
+		}
+		plan.Estimates = append(plan.Estimates, estimate(SideWarmup, baseCount, c.WarmupCount, warmupTime))
+		plan.Cooldown = c.Cooldown
+	}
+	if baseCached {
+		plan.Estimates = append(plan.Estimates, SideEstimate{Side: SideBase, Source: EstimateFromCache})
+	} else {
+		plan.Estimates = append(plan.Estimates, estimate(SideBase, baseCount, c.Count, opts.Benchtime))
+	}
+	plan.Estimates = append(plan.Estimates, estimate(SideHead, headCount, c.Count, opts.Benchtime))
+	return plan, nil
+}
+
+// benchtimeDuration returns the time each sample of a benchmark runs with -benchtime set to
+// benchtime. It returns false when benchtime is an iteration count like "100x".
+func benchtimeDuration(benchtime string) (time.Duration, bool) {
+	if benchtime == "" {
+		return time.Second, true
+	}
+	d, err := time.ParseDuration(benchtime)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
+var listResultRegexp = regexp.MustCompile(`^(?:ok|\?|FAIL)\s+(\S+)`)
+
+// testListError is returned by testList when go test fails without reporting which package failed
+type testListError struct {
+	reason string
+}
+
+func (e *testListError) Error() string {
+	return e.reason
+}
+
+// listBenchmarks runs "go test -list" in dir and returns the benchmarks it finds. Packages that go
+// test can't load or build are returned as failures on side instead of an error.
+func (c *Benchdiff) listBenchmarks(dir, side string, opts *PlanOptions) ([]PlannedBenchmark, []Failure, error) {
+	packages := c.Packages
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+	benchmarks, failures, err := c.testList(dir, side, opts, packages)
+	var listErr *testListError
+	if !errors.As(err, &listErr) {
+		return benchmarks, failures, err
+	}
+	// go test doesn't list anything when one of the packages doesn't exist, so list them one at a time
+	benchmarks, failures = nil, nil
+	for _, pkg := range packages {
+		var pkgBenchmarks []PlannedBenchmark
+		var pkgFailures []Failure
+		pkgBenchmarks, pkgFailures, err = c.testList(dir, side, opts, []string{pkg})
+		if errors.As(err, &listErr) {
+			failures = append(failures, Failure{
+				Side:    side,
+				Package: pkg,
+				Reason:  listErr.reason,
+			})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		benchmarks = append(benchmarks, pkgBenchmarks...)
+		failures = append(failures, pkgFailures...)
+	}
+	return benchmarks, failures, nil
+}
+
+// testList runs "go test -list" for packages in dir. Packages that go test reports as failed, like
+// "FAIL example.com/foo [build failed]", are returned as failures on side. It returns a
+// *testListError when go test fails without reporting a failed package.
+func (c *Benchdiff) testList(dir, side string, opts *PlanOptions, packages []string) ([]PlannedBenchmark, []Failure, error) {
+	bench := opts.Bench
+	if bench == "" {
+		bench = "."
+	}
+	// -list only matches top level names
+	bench = strings.Split(bench, "/")[0]
+	args := []string{"test", "-list", bench}
+	if opts.Tags != "" {
+		args = append(args, "-tags", opts.Tags)
+	}
+	args = append(args, packages...)
+	var stdout, stderr bytes.Buffer
+	cmd := NewCommand(c.BenchCmd, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	result, err := runCmd(c.runner(), cmd, c.debug())
+	if result == nil {
+		return nil, nil, err
+	}
+	var benchmarks, pending []PlannedBenchmark
+	var failures []Failure
+	pkgErrors := packageErrors(stderr.String())
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := listResultRegexp.FindStringSubmatch(line); m != nil {
+			if strings.HasPrefix(line, "FAIL") {
+				failures = append(failures, Failure{
+					Side:    side,
+					Package: m[1],
+					Reason:  listFailureReason(line, pkgErrors[m[1]]),
+				})
+				pending = nil
+				continue
+			}
+			for _, b := range pending {
+				b.Package = m[1]
+				benchmarks = append(benchmarks, b)
+			}
+			pending = nil
+			continue
+		}
+		if strings.HasPrefix(line, "Benchmark") {
+			pending = append(pending, PlannedBenchmark{Benchmark: line})
+		}
+	}
+	if err != nil && len(failures) == 0 {
+		return nil, nil, &testListError{reason: failureReason(result.ExitCode, stderr.String())}
+	}
+	return benchmarks, failures, nil
+}
+
+// listFailureReason returns the reason for a go test result line like
+// "FAIL	example.com/foo [build failed]". pkgErrors are the errors go test wrote for the package.
+func listFailureReason(line, pkgErrors string) string {
+	if pkgErrors != "" {
+		return pkgErrors
+	}
+	i := strings.IndexByte(line, '[')
+	if i == -1 || !strings.HasSuffix(line, "]") {
+		return "go test -list failed"
+	}
+	return line[i+1 : len(line)-1]
+}
+
+// packageErrors splits go test's stderr into the errors for each package. go test writes them
+// under a "# example.com/foo" line.
+func packageErrors(stderr string) map[string]string {
+	errs := map[string]string{}
+	pkg := ""
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			pkg = strings.TrimPrefix(line, "# ")
+			continue
+		}
+		if pkg == "" || line == "" {
+			continue
+		}
+		if errs[pkg] != "" {
+			errs[pkg] += "\n"
+		}
+		errs[pkg] += line
+	}
+	return errs
+}
+
+// mergePlannedBenchmarks combines the benchmarks listed on each side sorted by package and name.
+func mergePlannedBenchmarks(base, head []PlannedBenchmark) []PlannedBenchmark {
+	type key struct{ pkg, name string }
+	merged := map[key]*PlannedBenchmark{}
+	get := func(b PlannedBenchmark) *PlannedBenchmark {
+		k := key{pkg: b.Package, name: b.Benchmark}
+		if merged[k] == nil {
+			merged[k] = &PlannedBenchmark{Package: b.Package, Benchmark: b.Benchmark}
+		}
+		return merged[k]
+	}
+	for _, b := range base {
+		get(b).Base = true
+	}
+	for _, b := range head {
+		get(b).Head = true
+	}
+	result := make([]PlannedBenchmark, 0, len(merged))
+	for _, b := range merged {
+		result = append(result, *b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Package != result[j].Package {
+			return result[i].Package < result[j].Package
+		}
+		return result[i].Benchmark < result[j].Benchmark
+	})
+	return result
+}
+
+// Total returns the estimated time for the whole run. It is a lower bound when any side is unknown.
+func (p *Plan) Total() time.Duration {
+	total := p.Cooldown
+	for _, est := range p.Estimates {
+		total += est.Duration
+	}
+	return total
+}
+
+// WritePlan writes p to w as text or JSON
+func (p *Plan) WritePlan(w io.Writer, jsonOutput bool) error {
+	if jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(p)
+	}
+	var buf bytes.Buffer
+	if p.BenchCmd != "" {
+		fmt.Fprintf(&buf, "bench command:\n  %s\n", p.BenchCmd)
+	}
+	fmt.Fprintf(&buf, "base sha:\n  %s\n", p.BaseSHA)
+	if len(p.SelectedPackages) > 0 {
+		fmt.Fprintf(&buf, "selected packages:\n")
+		for _, s := range p.SelectedPackages {
+			fmt.Fprintf(&buf, "  %s: %s\n", s.Package, s.Reason)
+		}
+	}
+	fmt.Fprintf(&buf, "benchmarks:\n")
+	pkg := ""
+	for _, b := range p.Benchmarks {
+		if b.Package != pkg {
+			pkg = b.Package
+			fmt.Fprintf(&buf, "  %s\n", pkg)
+		}
+		note := ""
+		switch {
+		case !b.Head:
+			note = " (base only)"
+		case !b.Base:
+			note = " (head only)"
+		}
+		fmt.Fprintf(&buf, "    %s%s\n", b.Benchmark, note)
+	}
+	if len(p.Failures) > 0 {
+		fmt.Fprintf(&buf, "failures:\n")
+		for _, f := range p.Failures {
+			fmt.Fprintf(&buf, "  %s\n", f)
+			for _, line := range strings.Split(f.Reason, "\n") {
+				fmt.Fprintf(&buf, "    %s\n", line)
+			}
+		}
+	}
+	total := "estimated time:"
+	for _, est := range p.Estimates {
+		if est.Source == EstimateUnknown {
+			total = "estimated time (at least):"
+		}
+	}
+	fmt.Fprintf(&buf, "%s\n  %s\n", total, p.Total().Round(time.Second))
+	for _, est := range p.Estimates {
+		switch est.Source {
+		case EstimateFromCache:
+			fmt.Fprintf(&buf, "  %s: cached\n", est.Side)
+		case EstimateUnknown:
+			fmt.Fprintf(&buf, "  %s: unknown\n", est.Side)
+		default:
+			fmt.Fprintf(&buf, "  %s: %s (from %s)\n", est.Side, est.Duration.Round(time.Second), est.Source)
+		}
+	}
+	if p.Cooldown > 0 {
+		fmt.Fprintf(&buf, "  cooldown: %s\n", p.Cooldown)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
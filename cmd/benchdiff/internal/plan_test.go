@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchdiff_Plan(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	err := os.MkdirAll(filepath.Join(dir, "ex2"), 0o700)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "ex2", "ex2_test.go"), []byte(ex2Bench), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		GitCmd:      "git",
+		BenchCmd:    "go",
+		BenchArgs:   "test -bench . -count 2 ./...",
+		ResultsDir:  "./tmp",
+		BaseRef:     "HEAD",
+		Path:        ".",
+		Packages:    []string{"./..."},
+		Count:       2,
+		WarmupCount: 1,
+		Cooldown:    time.Second,
+	}
+	plan, err := differ.Plan(&PlanOptions{Bench: "."})
+	require.NoError(t, err)
+	require.Equal(t, []PlannedBenchmark{
+		{Package: "bindiff.test", Benchmark: "BenchmarkDoNothing", Base: true, Head: true},
+		{Package: "bindiff.test/ex2", Benchmark: "BenchmarkEx2", Head: true},
+	}, plan.Benchmarks)
+	require.Equal(t, []SideEstimate{
+		{Side: SideWarmup, Duration: time.Second, Source: EstimateFromBenchtime},
+		{Side: SideBase, Duration: 2 * time.Second, Source: EstimateFromBenchtime},
+		{Side: SideHead, Duration: 4 * time.Second, Source: EstimateFromBenchtime},
+	}, plan.Estimates)
+	require.Equal(t, 8*time.Second, plan.Total())
+
+	err = writeTimings(differ.timingsFilename(), map[string]time.Duration{
+		differ.timingKey(SideHead): time.Minute,
+	})
+	require.NoError(t, err)
+	plan, err = differ.Plan(&PlanOptions{Bench: ".", Benchtime: "10x"})
+	require.NoError(t, err)
+	require.Equal(t, []SideEstimate{
+		{Side: SideWarmup, Source: EstimateUnknown},
+		{Side: SideBase, Source: EstimateUnknown},
+		{Side: SideHead, Duration: time.Minute, Source: EstimateFromHistory},
+	}, plan.Estimates)
+	var buf bytes.Buffer
+	err = plan.WritePlan(&buf, false)
+	require.NoError(t, err)
+	require.Equal(t, `bench command:
+  go test -bench . -count 2 ./...
+base sha:
+  `+plan.BaseSHA+`
+benchmarks:
+  bindiff.test
+    BenchmarkDoNothing
+  bindiff.test/ex2
+    BenchmarkEx2 (head only)
+estimated time (at least):
+  1m1s
+  warmup: unknown
+  base: unknown
+  head: 1m0s (from history)
+  cooldown: 1s
+`, buf.String())
+}
+
+func TestBenchdiff_Plan_partial(t *testing.T) {
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	err := os.MkdirAll(filepath.Join(dir, "ex2"), 0o700)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "ex2", "ex2_test.go"), []byte(ex2Bench), 0o600)
+	require.NoError(t, err)
+	differ := Benchdiff{
+		GitCmd:     "git",
+		BenchCmd:   "go",
+		BenchArgs:  "test -bench . -count 2 . ./ex2",
+		ResultsDir: "./tmp",
+		BaseRef:    "HEAD",
+		Path:       ".",
+		Packages:   []string{".", "./ex2"},
+		Count:      2,
+	}
+	// ./ex2 doesn't exist in base
+	plan, err := differ.Plan(&PlanOptions{Bench: ".", CPU: []int{1, 2}})
+	require.NoError(t, err)
+	require.Equal(t, []PlannedBenchmark{
+		{Package: "bindiff.test", Benchmark: "BenchmarkDoNothing", Base: true, Head: true},
+		{Package: "bindiff.test/ex2", Benchmark: "BenchmarkEx2", Head: true},
+	}, plan.Benchmarks)
+	require.Len(t, plan.Failures, 1)
+	require.Equal(t, SideBase, plan.Failures[0].Side)
+	require.Equal(t, "./ex2", plan.Failures[0].Package)
+	require.Contains(t, plan.Failures[0].Reason, "directory not found")
+	// each benchmark runs once for each -cpu value
+	require.Equal(t, []SideEstimate{
+		{Side: SideBase, Duration: 4 * time.Second, Source: EstimateFromBenchtime},
+		{Side: SideHead, Duration: 8 * time.Second, Source: EstimateFromBenchtime},
+	}, plan.Estimates)
+
+	// a package that doesn't build in head
+	err = os.WriteFile(filepath.Join(dir, "ex2", "ex2_test.go"), []byte("package ex2\n\nfunc BenchmarkEx2(\n"), 0o600)
+	require.NoError(t, err)
+	plan, err = differ.Plan(&PlanOptions{Bench: "."})
+	require.NoError(t, err)
+	require.Equal(t, []PlannedBenchmark{
+		{Package: "bindiff.test", Benchmark: "BenchmarkDoNothing", Base: true, Head: true},
+	}, plan.Benchmarks)
+	require.Len(t, plan.Failures, 2)
+	require.Equal(t, SideHead, plan.Failures[1].Side)
+	require.Equal(t, "bindiff.test/ex2", plan.Failures[1].Package)
+	require.Contains(t, plan.Failures[1].Reason, "ex2_test.go:3")
+	var buf bytes.Buffer
+	err = plan.WritePlan(&buf, false)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `
+failures:
+  base ./ex2
+    `)
+	require.Contains(t, buf.String(), `
+  head bindiff.test/ex2
+    ex2/ex2_test.go:3`)
+}
+
+func TestBenchdiff_listBenchmarks_unreported(t *testing.T) {
+	// when go test fails without saying which package failed, each package is listed on its own
+	runner := &fakeRunner{exitCode: 1}
+	differ := Benchdiff{
+		BenchCmd: "go",
+		Packages: []string{"./a", "./b"},
+		Runner:   runner,
+	}
+	benchmarks, failures, err := differ.listBenchmarks(".", SideBase, &PlanOptions{})
+	require.NoError(t, err)
+	require.Empty(t, benchmarks)
+	require.Equal(t, []Failure{
+		{Side: SideBase, Package: "./a", Reason: "stderr from go"},
+		{Side: SideBase, Package: "./b", Reason: "stderr from go"},
+	}, failures)
+	require.Equal(t, []string{
+		"go test -list . ./a ./b",
+		"go test -list . ./a",
+		"go test -list . ./b",
+	}, runner.commands)
+}
+
+func TestBenchdiff_Plan_selectPackages(t *testing.T) {
+	dir := t.TempDir()
+	setupChangedRepo(t, dir)
+	testInDir(t, dir)
+	newDiffer := func() *Benchdiff {
+		return &Benchdiff{
+			GitCmd:     "git",
+			BenchCmd:   "go",
+			BenchArgs:  "test -bench . -count 2 ./...",
+			ResultsDir: "./tmp",
+			BaseRef:    "HEAD",
+			Path:       ".",
+			Packages:   []string{"./..."},
+			PackageBenchArgs: func(pkg string) (string, error) {
+				return "test -bench . -count 2 " + pkg, nil
+			},
+			Count: 2,
+		}
+	}
+	benchmarkNames := func(plan *Plan) []string {
+		var names []string
+		for _, b := range plan.Benchmarks {
+			names = append(names, b.Package+" "+b.Benchmark)
+		}
+		return names
+	}
+
+	differ := newDiffer()
+	differ.SelectChanged = true
+	plan, err := differ.Plan(nil)
+	require.NoError(t, err)
+	require.Len(t, plan.SelectedPackages, 3)
+	require.Equal(t, "go test -bench . -count 2 bindiff.test bindiff.test/dep bindiff.test/testdep", plan.BenchCmd)
+	require.Equal(t, []string{
+		"bindiff.test BenchmarkDoNothing",
+		"bindiff.test/dep BenchmarkDep",
+		"bindiff.test/testdep BenchmarkTestDep",
+	}, benchmarkNames(plan))
+
+	differ = newDiffer()
+	differ.Shard = &Shard{Index: 2, Count: 2}
+	plan, err = differ.Plan(nil)
+	require.NoError(t, err)
+	require.Empty(t, plan.SelectedPackages)
+	require.Equal(t, []string{
+		"bindiff.test/dep BenchmarkDep",
+		"bindiff.test/testdep BenchmarkTestDep",
+	}, benchmarkNames(plan))
+
+	// shards of the changed packages like Run
+	differ.SelectChanged = true
+	differ.Shard = &Shard{Index: 1, Count: 2}
+	plan, err = differ.Plan(nil)
+	require.NoError(t, err)
+	require.Len(t, plan.SelectedPackages, 3)
+	require.Equal(t, []string{
+		"bindiff.test BenchmarkDoNothing",
+		"bindiff.test/testdep BenchmarkTestDep",
+	}, benchmarkNames(plan))
+
+	mustGit(t, dir, "checkout", "ex1.go")
+	plan, err = differ.Plan(nil)
+	require.NoError(t, err)
+	require.Empty(t, plan.Benchmarks)
+	require.Empty(t, plan.Estimates)
+	require.Zero(t, plan.Total())
+}
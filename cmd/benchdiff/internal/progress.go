@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// progress writes a live progress display to Benchdiff.Progress. It is an io.Writer that reads a
+// benchmark command's output as it is written. Both the benchmark format and "go test -json" events
+// are understood.
+type progress struct {
+	w        io.Writer
+	side     string
+	count    int           // expected samples of each benchmark. 0 when unknown
+	expected time.Duration // how long the side took last time. 0 when unknown
+	start    time.Time
+	now      func() time.Time
+
+	pkg          string
+	bench        string
+	samples      int
+	partial      string // output that hasn't been terminated by a newline yet
+	eventPartial string // the same for the output in test events
+}
+
+func newProgress(w io.Writer, side string, count int, expected time.Duration) *progress {
+	p := &progress{
+		w:        w,
+		side:     side,
+		count:    count,
+		expected: expected,
+		now:      time.Now,
+	}
+	p.start = p.now()
+	return p
+}
+
+// Write implements io.Writer. It never returns an error so a broken display can't fail the run.
+func (p *progress) Write(b []byte) (int, error) {
+	p.partial = p.lines(p.partial + string(b))
+	return len(b), nil
+}
+
+// lines handles each complete line in text and returns the rest
+func (p *progress) lines(text string) string {
+	for {
+		i := strings.IndexByte(text, '\n')
+		if i == -1 {
+			break
+		}
+		p.line(text[:i])
+		text = text[i+1:]
+	}
+	// go test writes the name of a benchmark and a tab before it starts running
+	if name, ok := runningBenchmark(text); ok && strings.HasSuffix(text, "\t") {
+		p.running(name)
+	}
+	return text
+}
+
+func (p *progress) line(line string) {
+	if strings.HasPrefix(line, "{") {
+		var event testEvent
+		if json.Unmarshal([]byte(line), &event) == nil && event.Action != "" {
+			p.eventPartial = p.lines(p.eventPartial + event.Output)
+			return
+		}
+	}
+	if strings.HasPrefix(line, "pkg: ") {
+		p.pkg = strings.TrimPrefix(line, "pkg: ")
+		return
+	}
+	if benchResultRegexp.MatchString(line) {
+		name := strings.Fields(line)[0]
+		if name != p.bench {
+			p.bench = name
+			p.samples = 0
+		}
+		p.samples++
+		p.display()
+		return
+	}
+	if name, ok := runningBenchmark(line); ok {
+		p.running(name)
+	}
+}
+
+// runningBenchmark returns the benchmark name when line is only a benchmark name
+func runningBenchmark(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 1 || !strings.HasPrefix(fields[0], "Benchmark") {
+		return "", false
+	}
+	return fields[0], true
+}
+
+func (p *progress) running(name string) {
+	if name == p.bench {
+		return
+	}
+	p.bench = name
+	p.samples = 0
+	p.display()
+}
+
+func (p *progress) display() {
+	status := fmt.Sprintf("[%s]", p.side)
+	if p.pkg != "" {
+		status += " " + p.pkg
+	}
+	status += " " + p.bench
+	if p.count > 0 {
+		status += fmt.Sprintf(" %d/%d", p.samples, p.count)
+	} else {
+		status += fmt.Sprintf(" %d", p.samples)
+	}
+	elapsed := p.now().Sub(p.start)
+	status += fmt.Sprintf(" (%s elapsed", elapsed.Round(time.Second))
+	if p.expected > elapsed {
+		status += fmt.Sprintf(", about %s left", (p.expected - elapsed).Round(time.Second))
+	}
+	fmt.Fprintln(p.w, status+")")
+}
+
+func (p *progress) done() {
+	fmt.Fprintf(p.w, "[%s] done in %s\n", p.side, p.now().Sub(p.start).Round(time.Second))
+}
+
+// progressWriter returns a writer that sends output to w and the progress display
+func (c *Benchdiff) progressWriter(w io.Writer) io.Writer {
+	switch {
+	case c.progress == nil:
+		return w
+	case w == nil:
+		return c.progress
+	default:
+		return io.MultiWriter(w, c.progress)
+	}
+}
+
+// sideCount returns the number of samples of each benchmark expected on side
+func (c *Benchdiff) sideCount(side *WrapperData) int {
+	switch {
+	case side.warmup():
+		return c.WarmupCount
+	case c.BuildTime != nil:
+		return c.BuildTime.count()
+	case c.Command != nil:
+		return c.Command.count()
+	default:
+		return c.Count
+	}
+}
+
+// execSide runs execBenchCmd. With c.Progress set, it shows a progress display and records how
+// long the side took so the next run can estimate how long it will take.
+func (c *Benchdiff) execSide(cmd *Command, side *WrapperData, logDir string) ([]Failure, error) {
+	if c.Progress == nil {
+		return c.execBenchCmd(cmd, side, logDir)
+	}
+	timings := readTimings(c.timingsFilename())
+	key := c.timingKey(side.Side)
+	start := time.Now()
+	c.progress = newProgress(c.Progress, side.Side, c.sideCount(side), timings[key])
+	defer func() {
+		c.progress = nil
+	}()
+	failures, err := c.execBenchCmd(cmd, side, logDir)
+	if err != nil {
+		return nil, err
+	}
+	c.progress.done()
+	timings[key] = time.Since(start)
+	return failures, writeTimings(c.timingsFilename(), timings)
+}
+
+// timingsFilename returns the file where the time each side took is kept
+func (c *Benchdiff) timingsFilename() string {
+	return filepath.Join(c.ResultsDir, "benchdiff-timings.json")
+}
+
+// timingKey returns the key for side in the timings file
+func (c *Benchdiff) timingKey(side string) string {
+	return c.cacheKey() + " " + side
+}
+
+// readTimings returns the times recorded in filename. A file that is missing or can't be read or
+// parsed is no history, so it never stops a run.
+func readTimings(filename string) map[string]time.Duration {
+	timings := map[string]time.Duration{}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return timings
+	}
+	err = json.Unmarshal(data, &timings)
+	if err != nil {
+		return map[string]time.Duration{}
+	}
+	return timings
+}
+
+func writeTimings(filename string, timings map[string]time.Duration) error {
+	data, err := json.MarshalIndent(timings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o666)
+}
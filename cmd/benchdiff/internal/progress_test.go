@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_progress(t *testing.T) {
+	for _, td := range []struct {
+		name   string
+		writes []string
+	}{
+		{
+			name: "text",
+			writes: []string{
+				"goos: linux\npkg: x/a\nBenchmarkFoo-8   \t",
+				"      10\t        16.70 ns/op\nBenchmarkFoo-8   \t      10\t        16.70 ns/op\n",
+				"BenchmarkBar-8   \t      10\t",
+				"        16.70 ns/op\n",
+			},
+		},
+		{
+			name: "json",
+			writes: []string{
+				`{"Action":"output","Package":"x/a","Output":"pkg: x/a\n"}` + "\n",
+				`{"Action":"run","Package":"x/a","Test":"BenchmarkFoo"}` + "\n",
+				`{"Action":"output","Package":"x/a","Test":"BenchmarkFoo","Output":"BenchmarkFoo-8\n"}` + "\n",
+				`{"Action":"output","Package":"x/a","Test":"BenchmarkFoo","Output":"BenchmarkFoo-8   \t      10\t        16.70 ns/op\n"}` + "\n",
+				`{"Action":"output","Package":"x/a","Test":"BenchmarkFoo","Output":"BenchmarkFoo-8   \t      10\t        16.70 ns/op\n"}` + "\n",
+				`{"Action":"output","Package":"x/a","Test":"BenchmarkBar","Output":"BenchmarkBar-8   \t      10"}` + "\n",
+				`{"Action":"output","Package":"x/a","Test":"BenchmarkBar","Output":"\t        16.70 ns/op\n"}` + "\n",
+			},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			p := newProgress(&buf, SideHead, 2, time.Minute)
+			p.now = func() time.Time {
+				return p.start.Add(20 * time.Second)
+			}
+			for _, w := range td.writes {
+				n, err := p.Write([]byte(w))
+				require.NoError(t, err)
+				require.Equal(t, len(w), n)
+			}
+			p.done()
+			require.Equal(t, `[head] x/a BenchmarkFoo-8 0/2 (20s elapsed, about 40s left)
+[head] x/a BenchmarkFoo-8 1/2 (20s elapsed, about 40s left)
+[head] x/a BenchmarkFoo-8 2/2 (20s elapsed, about 40s left)
+[head] x/a BenchmarkBar-8 1/2 (20s elapsed, about 40s left)
+[head] done in 20s
+`, buf.String())
+		})
+	}
+}
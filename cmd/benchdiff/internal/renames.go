@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RenameRule renames benchmarks in the base results so they can be compared with benchmarks that
+// were renamed in head.
+type RenameRule struct {
+	// Pattern is matched against the full benchmark name, including the "Benchmark" prefix but
+	// without the GOMAXPROCS suffix. For example "BenchmarkParse/small".
+	Pattern *regexp.Regexp
+
+	// Replacement replaces the match. It may refer to capture groups like $1.
+	Replacement string
+}
+
+const renameRuleSeparator = "=>"
+
+// ParseRenameRule parses a RenameRule from a string in the form "pattern=>replacement"
+func ParseRenameRule(s string) (RenameRule, error) {
+	pattern, replacement, ok := strings.Cut(s, renameRuleSeparator)
+	if !ok {
+		return RenameRule{}, fmt.Errorf("invalid rename rule %q: missing %q", s, renameRuleSeparator)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return RenameRule{}, fmt.Errorf("invalid rename rule %q: %v", s, err)
+	}
+	return RenameRule{
+		Pattern:     re,
+		Replacement: replacement,
+	}, nil
+}
+
+var procsSuffixRegexp = regexp.MustCompile(`-(\d+)$`)
+
+// procsSuffix returns the "-N" suffix go test adds to the names of benchmarks run with GOMAXPROCS N
+// when N is one of procs. It returns "" for other numeric suffixes like the one in
+// "BenchmarkSize-1024" so they stay part of the name.
+func procsSuffix(name string, procs []int) string {
+	match := procsSuffixRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return ""
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n == 1 {
+		// go test doesn't add a suffix for GOMAXPROCS 1
+		return ""
+	}
+	for _, p := range procs {
+		if p == n {
+			return match[0]
+		}
+	}
+	return ""
+}
+
+// renameBenchmark applies the first matching rule to name. procs are the GOMAXPROCS values
+// the benchmarks ran with.
+func renameBenchmark(name string, rules []RenameRule, procs []int) string {
+	suffix := procsSuffix(name, procs)
+	base := strings.TrimSuffix(name, suffix)
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(base) {
+			return rule.Pattern.ReplaceAllString(base, rule.Replacement) + suffix
+		}
+	}
+	return name
+}
+
+// renameBenchmarks applies rules to the name of each benchmark result in data.
+func renameBenchmarks(data []byte, rules []RenameRule, procs []int) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Benchmark") {
+			name := strings.Fields(line)[0]
+			line = renameBenchmark(name, rules, procs) + line[len(name):]
+		}
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// renameBaseBenchmarks writes a copy of the base results in filename with c.Renames applied and
+// returns the name of the new file.
+func (c *Benchdiff) renameBaseBenchmarks(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	data, err = renameBenchmarks(data, c.Renames, c.procs())
+	if err != nil {
+		return "", err
+	}
+	renamedFilename := filepath.Join(c.ResultsDir, "benchdiff-base-renamed.out")
+	err = os.WriteFile(renamedFilename, data, 0o666)
+	if err != nil {
+		return "", err
+	}
+	return renamedFilename, nil
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRenameRule(t *testing.T) {
+	rule, err := ParseRenameRule(`^BenchmarkParse/(\w+)$=>BenchmarkParse/size=$1`)
+	require.NoError(t, err)
+	require.Equal(t, `^BenchmarkParse/(\w+)$`, rule.Pattern.String())
+	require.Equal(t, `BenchmarkParse/size=$1`, rule.Replacement)
+
+	_, err = ParseRenameRule(`BenchmarkParse`)
+	require.EqualError(t, err, `invalid rename rule "BenchmarkParse": missing "=>"`)
+
+	_, err = ParseRenameRule(`(=>foo`)
+	require.Error(t, err)
+}
+
+func Test_renameBenchmarks(t *testing.T) {
+	var rules []RenameRule
+	for _, s := range []string{
+		`^BenchmarkParse/(\w+)$=>BenchmarkParse/size=$1`,
+		`^BenchmarkOld$=>BenchmarkNew`,
+	} {
+		rule, err := ParseRenameRule(s)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	input := `goos: linux
+pkg: example.com/foo
+BenchmarkParse/small-8   	 1000	      1200 ns/op
+BenchmarkParse/size=large-8   	 1000	      9000 ns/op
+BenchmarkOld   	 1000	      10 ns/op
+BenchmarkOldest-8   	 1000	      10 ns/op
+PASS
+`
+	want := `goos: linux
+pkg: example.com/foo
+BenchmarkParse/size=small-8   	 1000	      1200 ns/op
+BenchmarkParse/size=large-8   	 1000	      9000 ns/op
+BenchmarkNew   	 1000	      10 ns/op
+BenchmarkOldest-8   	 1000	      10 ns/op
+PASS
+`
+	got, err := renameBenchmarks([]byte(input), rules, []int{8})
+	require.NoError(t, err)
+	require.Equal(t, want, string(got))
+}
+
+func Test_renameBenchmarks_numericSuffix(t *testing.T) {
+	rule, err := ParseRenameRule(`^BenchmarkSize-(\d+)$=>BenchmarkSize/bytes=$1`)
+	require.NoError(t, err)
+	input := `BenchmarkSize-1024   	 1000	      1200 ns/op
+BenchmarkSize-1024-8   	 1000	      1200 ns/op
+BenchmarkSize-8   	 1000	      1200 ns/op
+`
+	want := `BenchmarkSize/bytes=1024   	 1000	      1200 ns/op
+BenchmarkSize/bytes=1024-8   	 1000	      1200 ns/op
+BenchmarkSize-8   	 1000	      1200 ns/op
+`
+	got, err := renameBenchmarks([]byte(input), []RenameRule{rule}, []int{8})
+	require.NoError(t, err)
+	require.Equal(t, want, string(got))
+}
+
+func Test_procsSuffix(t *testing.T) {
+	procs := []int{1, 4, 8}
+	for name, want := range map[string]string{
+		"Size-8":      "-8",
+		"Size-1024-4": "-4",
+		"Size-1024":   "",
+		"Size-1":      "",
+		"Size":        "",
+		"Size/a-b":    "",
+	} {
+		require.Equal(t, want, procsSuffix(name, procs), name)
+	}
+}
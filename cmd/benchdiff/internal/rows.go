@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"math"
+	"strings"
+
+	"github.com/willabides/benchdiff/pkg/benchstatter"
+	"golang.org/x/perf/benchstat"
+)
+
+// geomeanBenchmark is the name benchstat gives the row it adds with Benchstat.AddGeoMean
+const geomeanBenchmark = "[Geo mean]"
+
+// ComparedRow is a benchmark with results on both sides in one benchstat table
+type ComparedRow struct {
+	Group     string                           `json:"group,omitempty"`
+	Package   string                           `json:"package,omitempty"` // from the pkg label of the group
+	Benchmark string                           `json:"benchmark"`
+	Metric    string                           `json:"metric"`       // the table like "time/op"
+	Unit      string                           `json:"unit"`         // the unit of Old and New like "ns/op"
+	Old       float64                          `json:"old"`          // mean of the base results without outliers
+	New       float64                          `json:"new"`          // mean of the head results without outliers
+	PctDelta  float64                          `json:"pct_delta"`    // 0 unless the change is significant
+	CI        *benchstatter.ConfidenceInterval `json:"ci,omitempty"` // the change in the median. nil unless the Benchstat has a ConfidenceLevel
+	P         float64                          `json:"p"`            // the p-value of the delta test after any correction. 1 when there wasn't enough data for the test
+	Change    BenchmarkChangeType              `json:"change"`
+}
+
+// Delta returns New - Old
+func (c *ComparedRow) Delta() float64 {
+	return c.New - c.Old
+}
+
+// Rows returns the rows of every benchstat table comparing base and head. Geomean rows are left out.
+func (r *RunResult) Rows() []ComparedRow {
+	var rows []ComparedRow
+	for _, table := range r.tables {
+		for _, row := range table.Rows {
+			if row.Benchmark == geomeanBenchmark || len(row.Metrics) != 2 {
+				continue
+			}
+			group := row.Group
+			if group == "" && len(table.Groups) == 1 {
+				// benchstat only labels rows when there are several groups
+				group = table.Groups[0]
+			}
+			var ci *benchstatter.ConfidenceInterval
+			if interval, ok := r.cis[row]; ok {
+				ci = &interval
+			}
+			rows = append(rows, ComparedRow{
+				Group:     row.Group,
+				Package:   groupPackage(group),
+				Benchmark: row.Benchmark,
+				Metric:    table.Metric,
+				Unit:      row.Metrics[1].Unit,
+				Old:       row.Metrics[0].Mean,
+				New:       row.Metrics[1].Mean,
+				PctDelta:  row.PctDelta,
+				CI:        ci,
+				P:         r.rowPValue(row),
+				Change:    BenchmarkChangeType(row.Change),
+			})
+		}
+	}
+	return rows
+}
+
+// groupPackage returns the pkg label from a benchstat group like "pkg:example.com/foo goos:linux"
+func groupPackage(group string) string {
+	for _, label := range strings.Fields(group) {
+		if strings.HasPrefix(label, "pkg:") {
+			return strings.TrimPrefix(label, "pkg:")
+		}
+	}
+	return ""
+}
+
+// rowPValue returns the p-value of row's delta test. Rows without one are either significant
+// because there is no delta test or couldn't be tested.
+func (r *RunResult) rowPValue(row *benchstat.Row) float64 {
+	if p, ok := r.rowPValues[row]; ok {
+		return p
+	}
+	if row.Change != InsignificantChange {
+		return 0
+	}
+	return 1
+}
+
+// SummaryRows returns a row for each metric comparing the geometric means of Old and New across
+// every row of the metric with positive means. There is no delta test for these rows, so PctDelta
+// is always set, P is 1 and Change is InsignificantChange.
+func (r *RunResult) SummaryRows() []ComparedRow {
+	type logSums struct {
+		old, new float64
+		n        int
+		unit     string
+	}
+	var metrics []string
+	sums := map[string]*logSums{}
+	for _, row := range r.Rows() {
+		if row.Old <= 0 || row.New <= 0 {
+			continue
+		}
+		sum := sums[row.Metric]
+		if sum == nil {
+			sum = &logSums{unit: row.Unit}
+			sums[row.Metric] = sum
+			metrics = append(metrics, row.Metric)
+		}
+		sum.old += math.Log(row.Old)
+		sum.new += math.Log(row.New)
+		sum.n++
+	}
+	rows := make([]ComparedRow, len(metrics))
+	for i, metric := range metrics {
+		sum := sums[metric]
+		oldMean := math.Exp(sum.old / float64(sum.n))
+		newMean := math.Exp(sum.new / float64(sum.n))
+		rows[i] = ComparedRow{
+			Benchmark: geomeanBenchmark,
+			Metric:    metric,
+			Unit:      sum.unit,
+			Old:       oldMean,
+			New:       newMean,
+			PctDelta:  (newMean/oldMean - 1) * 100,
+			P:         1,
+			Change:    InsignificantChange,
+		}
+	}
+	return rows
+}
+
+// AdjustedPValue is the p-value of a row before and after correcting for multiple comparisons
+type AdjustedPValue struct {
+	Group     string  `json:"group,omitempty"`
+	Benchmark string  `json:"benchmark"`
+	Metric    string  `json:"metric"`
+	P         float64 `json:"p"`
+	AdjustedP float64 `json:"adjusted_p"`
+}
+
+// AdjustedPValues returns the p-value of every tested row when the Benchstat had a Correction. The
+// adjusted p-value is the one that decided whether the row changed.
+func (r *RunResult) AdjustedPValues() []AdjustedPValue {
+	if len(r.pValues) == 0 {
+		return nil
+	}
+	values := make([]AdjustedPValue, len(r.pValues))
+	for i, p := range r.pValues {
+		values[i] = AdjustedPValue{
+			Group:     p.Row.Group,
+			Benchmark: p.Row.Benchmark,
+			Metric:    p.Table.Metric,
+			P:         p.P,
+			AdjustedP: p.Adjusted,
+		}
+	}
+	return values
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/perf/benchstat"
+)
+
+func TestRunResult_Rows(t *testing.T) {
+	row := &benchstat.Row{
+		Group:     "pkg:example.com/foo",
+		Benchmark: "Parse-8",
+		Metrics: []*benchstat.Metrics{
+			{Unit: "allocs/op", Mean: 2},
+			{Unit: "allocs/op", Mean: 3},
+		},
+		PctDelta: 50,
+		Note:     "(p=0.008 n=5+5)",
+		Change:   DegradingChange,
+	}
+	result := &RunResult{
+		tables: []*benchstat.Table{
+			{
+				Metric: "allocs/op",
+				Rows: []*benchstat.Row{
+					row,
+					{
+						Benchmark: geomeanBenchmark,
+						Metrics: []*benchstat.Metrics{
+							{Unit: "allocs/op", Mean: 2},
+							{Unit: "allocs/op", Mean: 3},
+						},
+					},
+				},
+			},
+		},
+		// the note is rounded
+		rowPValues: map[*benchstat.Row]float64{row: 0.0079365},
+	}
+	require.Equal(t, []ComparedRow{
+		{
+			Group:     "pkg:example.com/foo",
+			Package:   "example.com/foo",
+			Benchmark: "Parse-8",
+			Metric:    "allocs/op",
+			Unit:      "allocs/op",
+			Old:       2,
+			New:       3,
+			PctDelta:  50,
+			P:         0.0079365,
+			Change:    DegradingChange,
+		},
+	}, result.Rows())
+}
+
+func TestRunResult_exitConditions(t *testing.T) {
+	result := &RunResult{}
+	require.True(t, result.IsEmpty())
+	require.False(t, result.HasImprovedResult())
+	require.False(t, result.HasFailures())
+
+	result.added = []BenchmarkID{{Benchmark: "New-8"}}
+	require.False(t, result.IsEmpty())
+
+	result = &RunResult{
+		tables: []*benchstat.Table{
+			{
+				Metric: "time/op",
+				Rows: []*benchstat.Row{
+					testRow("Same-8", 0, InsignificantChange),
+				},
+			},
+		},
+		failures: []Failure{{Side: SideHead, Package: "example.com/foo", Reason: "oops"}},
+	}
+	require.False(t, result.IsEmpty())
+	require.False(t, result.HasImprovedResult())
+	require.True(t, result.HasFailures())
+
+	result.tables[0].Rows = append(result.tables[0].Rows, testRow("Faster-8", -20, ImprovingChange))
+	require.True(t, result.HasImprovedResult())
+}
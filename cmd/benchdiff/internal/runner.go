@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// Command is a command for a Runner to run
+type Command struct {
+	Path   string    // the executable to run. It is looked up in PATH when it contains no path separators.
+	Args   []string  // arguments not including Path
+	Dir    string    // working directory. When empty, the runner's working directory is used.
+	Env    []string  // environment in the form "key=value". When nil, the runner's environment is used.
+	Stdin  io.Reader // when nil, stdin is empty
+	Stdout io.Writer // when nil, stdout is discarded
+	Stderr io.Writer // when nil, stderr is discarded
+}
+
+// NewCommand returns a *Command that runs path with args
+func NewCommand(path string, args ...string) *Command {
+	return &Command{
+		Path: path,
+		Args: args,
+	}
+}
+
+// String returns a human-readable description of c
+func (c *Command) String() string {
+	return strings.Join(append([]string{c.Path}, c.Args...), " ")
+}
+
+// CommandResult is the result of running a Command
+type CommandResult struct {
+	ExitCode int
+	Usage    *ResourceUsage // nil when the Runner can't measure resource usage
+}
+
+// Runner runs commands. Benchdiff uses it for everything it executes including git and go.
+type Runner interface {
+	// Run runs cmd and waits for it to exit. A non-zero exit code is reported in the result and
+	// is not an error.
+	Run(cmd *Command) (*CommandResult, error)
+}
+
+// ExecRunner is a Runner that runs commands locally using os/exec
+type ExecRunner struct{}
+
+// Run implements Runner
+func (ExecRunner) Run(cmd *Command) (*CommandResult, error) {
+	execCmd := exec.Command(cmd.Path, cmd.Args...)
+	execCmd.Dir = cmd.Dir
+	execCmd.Env = cmd.Env
+	execCmd.Stdin = cmd.Stdin
+	execCmd.Stdout = cmd.Stdout
+	execCmd.Stderr = cmd.Stderr
+	err := execCmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+	return &CommandResult{
+		ExitCode: execCmd.ProcessState.ExitCode(),
+		Usage:    processUsage(execCmd.ProcessState),
+	}, nil
+}
+
+func (c *Benchdiff) runner() Runner {
+	if c.Runner == nil {
+		return ExecRunner{}
+	}
+	return c.Runner
+}
+
+// runCmd runs cmd with runner sending its stdout and stderr to debug.Write(). It returns an error
+// when cmd exits with a non-zero exit code. A nil runner is an ExecRunner.
+func runCmd(runner Runner, cmd *Command, debug *log.Logger) (*CommandResult, error) {
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	if debug == nil {
+		debug = log.New(io.Discard, "", 0)
+	}
+	var bufStderr bytes.Buffer
+	stderr := io.MultiWriter(&bufStderr, debug.Writer())
+	if cmd.Stderr != nil {
+		stderr = io.MultiWriter(cmd.Stderr, stderr)
+	}
+	stdout := debug.Writer()
+	if cmd.Stdout != nil {
+		stdout = io.MultiWriter(cmd.Stdout, stdout)
+	}
+	toRun := *cmd
+	toRun.Stdout = stdout
+	toRun.Stderr = stderr
+	debug.Printf("+ %s", cmd)
+	result, err := runner.Run(&toRun)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return result, fmt.Errorf(`error running command: %s
+exit code: %d
+stderr: %s`, cmd.String(), result.ExitCode, bufStderr.String())
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRunner struct {
+	commands []string
+	exitCode int
+}
+
+func (r *fakeRunner) Run(cmd *Command) (*CommandResult, error) {
+	r.commands = append(r.commands, cmd.String())
+	_, err := fmt.Fprintf(cmd.Stdout, "stdout from %s\n", cmd.Path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(cmd.Stderr, "stderr from %s\n", cmd.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandResult{ExitCode: r.exitCode}, nil
+}
+
+func Test_runCmd(t *testing.T) {
+	t.Run("fake runner", func(t *testing.T) {
+		runner := new(fakeRunner)
+		var stdout bytes.Buffer
+		cmd := NewCommand("foo", "bar", "baz")
+		cmd.Stdout = &stdout
+		result, err := runCmd(runner, cmd, nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, result.ExitCode)
+		require.Equal(t, []string{"foo bar baz"}, runner.commands)
+		require.Equal(t, "stdout from foo\n", stdout.String())
+	})
+
+	t.Run("non-zero exit", func(t *testing.T) {
+		runner := &fakeRunner{exitCode: 3}
+		result, err := runCmd(runner, NewCommand("foo"), nil)
+		require.EqualError(t, err, `error running command: foo
+exit code: 3
+stderr: stderr from foo
+`)
+		require.Equal(t, 3, result.ExitCode)
+	})
+
+	t.Run("exec runner", func(t *testing.T) {
+		var stdout bytes.Buffer
+		cmd := NewCommand("go", "env", "GOVERSION")
+		cmd.Stdout = &stdout
+		result, err := runCmd(nil, cmd, nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, result.ExitCode)
+		require.NotNil(t, result.Usage)
+		require.Contains(t, stdout.String(), "go")
+	})
+
+	t.Run("exec runner exit code", func(t *testing.T) {
+		result, err := runCmd(nil, NewCommand("go", "not-a-go-command"), nil)
+		require.Error(t, err)
+		require.Equal(t, 2, result.ExitCode)
+	})
+}
+
+// recordingRunner runs commands with ExecRunner and records them
+type recordingRunner struct {
+	commands []string
+}
+
+func (r *recordingRunner) Run(cmd *Command) (*CommandResult, error) {
+	r.commands = append(r.commands, cmd.String())
+	return ExecRunner{}.Run(cmd)
+}
@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"os"
+	"time"
+)
+
+// ResourceUsage is the resource usage of a process that has exited
+type ResourceUsage struct {
+	UserTime         time.Duration
+	SystemTime       time.Duration
+	MaxRSS           int64 // peak resident set size in bytes. zero when unavailable
+	VolCtxSwitches   int64 // voluntary context switches. zero when unavailable
+	InvolCtxSwitches int64 // involuntary context switches. zero when unavailable
+}
+
+func processUsage(state *os.ProcessState) *ResourceUsage {
+	if state == nil {
+		return nil
+	}
+	usage := &ResourceUsage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+	}
+	addSysUsage(usage, state)
+	return usage
+}
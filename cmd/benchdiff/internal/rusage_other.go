@@ -0,0 +1,7 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package internal
+
+import "os"
+
+func addSysUsage(*ResourceUsage, *os.ProcessState) {}
@@ -0,0 +1,23 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package internal
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func addSysUsage(usage *ResourceUsage, state *os.ProcessState) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return
+	}
+	// ru_maxrss is in bytes on darwin and kilobytes everywhere else.
+	usage.MaxRSS = int64(rusage.Maxrss)
+	if runtime.GOOS != "darwin" {
+		usage.MaxRSS *= 1024
+	}
+	usage.VolCtxSwitches = int64(rusage.Nvcsw)
+	usage.InvolCtxSwitches = int64(rusage.Nivcsw)
+}
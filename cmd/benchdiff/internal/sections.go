@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sectionItem is an item in a section of human output
+type sectionItem struct {
+	title  string
+	detail string // optional multi-line detail
+}
+
+// writeSection writes items under header as an indented list, or as a markdown list when
+// markdown is true. It writes nothing when there are no items.
+func writeSection(w io.Writer, markdown bool, header string, items []sectionItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	var buf strings.Builder
+	if markdown {
+		fmt.Fprintf(&buf, "**%s**\n\n", header)
+	} else {
+		fmt.Fprintf(&buf, "%s:\n", header)
+	}
+	for _, item := range items {
+		detail := strings.TrimSpace(item.detail)
+		if markdown {
+			fmt.Fprintf(&buf, "- `%s`\n", item.title)
+			if detail != "" {
+				fmt.Fprintf(&buf, "\n  ```\n  %s\n  ```\n", strings.ReplaceAll(detail, "\n", "\n  "))
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "  %s\n", item.title)
+		if detail != "" {
+			fmt.Fprintf(&buf, "    %s\n", strings.ReplaceAll(detail, "\n", "\n    "))
+		}
+	}
+	if markdown {
+		buf.WriteString("\n")
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func benchmarkIDItems(ids []BenchmarkID) []sectionItem {
+	items := make([]sectionItem, len(ids))
+	for i, id := range ids {
+		items[i] = sectionItem{title: id.String()}
+	}
+	return items
+}
+
+func benchmarkRenameItems(renames []BenchmarkRename) []sectionItem {
+	items := make([]sectionItem, len(renames))
+	for i, rename := range renames {
+		items[i] = sectionItem{title: rename.String()}
+	}
+	return items
+}
+
+func degradedRowItems(rows []DegradedRow) []sectionItem {
+	items := make([]sectionItem, len(rows))
+	for i, row := range rows {
+		detail := fmt.Sprintf("over the default tolerance of %g%%", row.Tolerance)
+		switch {
+		case row.Benchmark == geomeanBenchmark:
+			detail = fmt.Sprintf("over the geomean tolerance of %g%%", row.Tolerance)
+		case row.Rule != "":
+			detail = fmt.Sprintf("over the tolerance of %g%% from rule %s", row.Tolerance, row.Rule)
+		}
+		if row.MinDelta > 0 {
+			detail += fmt.Sprintf("\nchanged by %g %s, over the minimum delta of %g", row.Delta(), row.Unit, row.MinDelta)
+		}
+		items[i] = sectionItem{
+			title:  row.String(),
+			detail: detail,
+		}
+	}
+	return items
+}
+
+func acceptedRowItems(rows []DegradedRow) []sectionItem {
+	items := make([]sectionItem, len(rows))
+	for i, row := range rows {
+		items[i] = sectionItem{
+			title:  row.String(),
+			detail: fmt.Sprintf("accepted by %s: %s in %s", acceptTrailer, row.Accept.Source, row.Accept.link()),
+		}
+	}
+	return items
+}
+
+func geomeanResultItems(results []GeomeanResult) []sectionItem {
+	items := make([]sectionItem, len(results))
+	for i, result := range results {
+		detail := fmt.Sprintf("within the tolerance of %g%%", result.Tolerance)
+		if result.Degraded {
+			detail = fmt.Sprintf("degraded over the tolerance of %g%%", result.Tolerance)
+		}
+		items[i] = sectionItem{
+			title:  result.String(),
+			detail: detail,
+		}
+	}
+	return items
+}
+
+func gateResultItems(results []GateResult) []sectionItem {
+	items := make([]sectionItem, len(results))
+	for i, result := range results {
+		items[i] = sectionItem{
+			title:  fmt.Sprintf("%s: %s", result.Name, result.Expression),
+			detail: strings.Join(result.Matches, "\n"),
+		}
+	}
+	return items
+}
+
+func selectedPackageItems(selected []SelectedPackage) []sectionItem {
+	items := make([]sectionItem, len(selected))
+	for i, s := range selected {
+		items[i] = sectionItem{
+			title:  s.Package,
+			detail: s.Reason,
+		}
+		if s.Side != "" {
+			items[i].title += " (only " + s.Side + ")"
+		}
+	}
+	return items
+}
+
+func failureItems(failures []Failure) []sectionItem {
+	items := make([]sectionItem, len(failures))
+	for i, failure := range failures {
+		items[i] = sectionItem{
+			title:  failure.String(),
+			detail: failure.Reason,
+		}
+	}
+	return items
+}
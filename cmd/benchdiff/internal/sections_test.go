@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_writeSection(t *testing.T) {
+	items := []sectionItem{
+		{title: "base ./foo"},
+		{title: "head ./bar", detail: "line 1\nline 2\n"},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writeSection(&buf, false, "failed packages", items)
+		require.NoError(t, err)
+		require.Equal(t, `failed packages:
+  base ./foo
+  head ./bar
+    line 1
+    line 2
+`, buf.String())
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writeSection(&buf, true, "failed packages", items)
+		require.NoError(t, err)
+		require.Equal(t, "**failed packages**\n\n"+
+			"- `base ./foo`\n"+
+			"- `head ./bar`\n\n"+
+			"  ```\n  line 1\n  line 2\n  ```\n\n", buf.String())
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writeSection(&buf, false, "failed packages", nil)
+		require.NoError(t, err)
+		require.Empty(t, buf.String())
+	})
+}
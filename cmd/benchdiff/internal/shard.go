@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Shard is one of Count parts of the packages a run benchmarks
+type Shard struct {
+	Index int // from 1 to Count
+	Count int
+}
+
+// ParseShard parses a shard in the form "i/n"
+func ParseShard(s string) (*Shard, error) {
+	index, count, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid shard %q: expected the form i/n", s)
+	}
+	shard := &Shard{}
+	var err error
+	shard.Index, err = strconv.Atoi(index)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard %q: %v", s, err)
+	}
+	shard.Count, err = strconv.Atoi(count)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard %q: %v", s, err)
+	}
+	if shard.Count < 1 || shard.Index < 1 || shard.Index > shard.Count {
+		return nil, fmt.Errorf("invalid shard %q: i must be between 1 and n", s)
+	}
+	return shard, nil
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// packages returns the shard's part of pkgs. pkgs are sorted and dealt out to shards in turn so
+// every shard gets the same packages for the same input regardless of order.
+func (s Shard) packages(pkgs []string) []string {
+	sorted := append([]string{}, pkgs...)
+	sort.Strings(sorted)
+	var result []string
+	for i, pkg := range sorted {
+		if i%s.Count == s.Index-1 {
+			result = append(result, pkg)
+		}
+	}
+	return result
+}
+
+// shardFile is what a sharded run saves for MergeShards
+type shardFile struct {
+	Shard       string    `json:"shard"`
+	HeadSHA     string    `json:"head_sha"`
+	BaseSHA     string    `json:"base_sha"`
+	BenchCmd    string    `json:"bench_command,omitempty"`
+	Packages    []string  `json:"packages"`
+	BaseResults string    `json:"base_results"`
+	HeadResults string    `json:"head_results"`
+	Failures    []Failure `json:"failures,omitempty"`
+}
+
+// runShard runs benchmarks in the packages assigned to c.Shard and saves the results to c.ShardFile
+func (c *Benchdiff) runShard() (*RunResult, error) {
+	if c.PackageBenchArgs == nil {
+		return nil, fmt.Errorf("PackageBenchArgs is required to run a shard")
+	}
+	pkgs, onBothSides, err := c.shardPackages()
+	if err != nil {
+		return nil, err
+	}
+	saved := &shardFile{
+		Shard:    c.Shard.String(),
+		Packages: pkgs,
+	}
+
+	var result *RunResult
+	if len(saved.Packages) == 0 {
+		result, err = c.emptyResult()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		differ := *c
+		differ.Shard = nil
+		differ.Packages = saved.Packages
+		for _, pkg := range saved.Packages {
+			if !onBothSides[pkg] {
+				// go test fails on the side that doesn't have pkg, so run each package separately
+				// and report its benchmarks as added or removed
+				differ.AllowPartial = true
+			}
+		}
+		differ.BenchArgs, err = c.PackageBenchArgs(strings.Join(saved.Packages, " "))
+		if err != nil {
+			return nil, err
+		}
+		result, err = differ.Run()
+		if err != nil {
+			return nil, err
+		}
+		var data []byte
+		data, err = os.ReadFile(result.baseOutputFile)
+		if err != nil {
+			return nil, err
+		}
+		saved.BaseResults = string(data)
+		data, err = os.ReadFile(result.headOutputFile)
+		if err != nil {
+			return nil, err
+		}
+		saved.HeadResults = string(data)
+	}
+	saved.HeadSHA = result.headSHA
+	saved.BaseSHA = result.baseSHA
+	saved.BenchCmd = result.benchCmd
+	saved.Failures = result.failures
+	if c.ShardFile == "" {
+		return result, nil
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return result, os.WriteFile(c.ShardFile, data, 0o666)
+}
+
+// shardPackages returns the packages with benchmarks in c.Packages that are assigned to c.Shard
+// and which of them exist on both sides. Packages on both sides are sharded so packages added or
+// removed since the base ref are too.
+func (c *Benchdiff) shardPackages() ([]string, map[string]bool, error) {
+	headPkgs, err := c.benchmarkPackages(c.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var basePkgs []string
+	var listErr error
+	err = runAtGitRef(c.runner(), c.debug(), c.gitCmd(), c.Path, c.BaseRef, func(workPath string) {
+		basePkgs, listErr = c.benchmarkPackages(workPath)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if listErr != nil {
+		return nil, nil, listErr
+	}
+	onHead := map[string]bool{}
+	for _, pkg := range headPkgs {
+		onHead[pkg] = true
+	}
+	onBothSides := map[string]bool{}
+	pkgs := headPkgs
+	for _, pkg := range basePkgs {
+		if onHead[pkg] {
+			onBothSides[pkg] = true
+			continue
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	pkgs = c.Shard.packages(pkgs)
+	c.debug().Printf("shard %s packages: %s", c.Shard, strings.Join(pkgs, " "))
+	return pkgs, onBothSides, nil
+}
+
+// benchmarkPackages returns the import paths of the packages in c.Packages that have benchmarks in
+// dir, the worktree of one side
+func (c *Benchdiff) benchmarkPackages(dir string) ([]string, error) {
+	listCmd := NewCommand(c.BenchCmd)
+	listCmd.Dir = dir
+	listed, err := c.listPackages(listCmd)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []string
+	for _, pkg := range listed {
+		if pkg.Error == nil && pkg.hasBenchmarks() {
+			pkgs = append(pkgs, pkg.ImportPath)
+		}
+	}
+	return pkgs, nil
+}
+
+// emptyResult returns the result of a run that had no benchmarks to run
+func (c *Benchdiff) emptyResult() (*RunResult, error) {
+	headSHA, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	baseSHA, err := runGitCmd(c.runner(), c.debug(), c.gitCmd(), c.Path, "rev-parse", c.BaseRef)
+	if err != nil {
+		return nil, err
+	}
+	return &RunResult{
+		headSHA: string(headSHA),
+		baseSHA: string(baseSHA),
+	}, nil
+}
+
+// MergeShards combines the files saved by runs with Shard and ShardFile set into a single result.
+// Every shard of the run must be included.
+func (c *Benchdiff) MergeShards(files ...string) (*RunResult, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no shard files to merge")
+	}
+	var first shardFile
+	var shards []shardFile // by shard index
+	seen := map[int]string{}
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var saved shardFile
+		err = json.Unmarshal(data, &saved)
+		if err != nil {
+			return nil, fmt.Errorf("error reading shard file %s: %v", file, err)
+		}
+		shard, err := ParseShard(saved.Shard)
+		if err != nil {
+			return nil, fmt.Errorf("error reading shard file %s: %v", file, err)
+		}
+		if i == 0 {
+			first = saved
+			shards = make([]shardFile, shard.Count)
+		}
+		switch {
+		case shard.Count != len(shards):
+			return nil, fmt.Errorf("%s is shard %s but %s is shard %s", file, shard, files[0], first.Shard)
+		case seen[shard.Index] != "":
+			return nil, fmt.Errorf("%s and %s are both shard %s", seen[shard.Index], file, shard)
+		case saved.HeadSHA != first.HeadSHA || saved.BaseSHA != first.BaseSHA:
+			return nil, fmt.Errorf("%s and %s compare different commits", files[0], file)
+		}
+		seen[shard.Index] = file
+		shards[shard.Index-1] = saved
+	}
+	for i := range shards {
+		if seen[i+1] == "" {
+			return nil, fmt.Errorf("missing shard %s", Shard{Index: i + 1, Count: len(shards)})
+		}
+	}
+	res := &runBenchmarksResults{
+		headSHA:            first.HeadSHA,
+		baseSHA:            first.BaseSHA,
+		baseOutputFile:     filepath.Join(c.ResultsDir, "benchdiff-merged-base.out"),
+		worktreeOutputFile: filepath.Join(c.ResultsDir, "benchdiff-merged-head.out"),
+	}
+	var baseResults, headResults strings.Builder
+	var benchCmds []string
+	for _, shard := range shards {
+		baseResults.WriteString(shard.BaseResults)
+		headResults.WriteString(shard.HeadResults)
+		if shard.BenchCmd != "" {
+			benchCmds = append(benchCmds, shard.BenchCmd)
+		}
+		res.failures = append(res.failures, shard.Failures...)
+	}
+	res.benchmarkCmd = strings.Join(benchCmds, "\n  ")
+	err := os.MkdirAll(c.ResultsDir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(res.baseOutputFile, []byte(baseResults.String()), 0o666)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(res.worktreeOutputFile, []byte(headResults.String()), 0o666)
+	if err != nil {
+		return nil, err
+	}
+	return c.compare(res)
+}
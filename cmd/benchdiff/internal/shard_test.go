@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/benchdiff/pkg/benchstatter"
+)
+
+func TestParseShard(t *testing.T) {
+	shard, err := ParseShard("2/3")
+	require.NoError(t, err)
+	require.Equal(t, &Shard{Index: 2, Count: 3}, shard)
+	for _, s := range []string{"2", "0/3", "4/3", "a/3", "1/b"} {
+		_, err = ParseShard(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestShard_packages(t *testing.T) {
+	pkgs := []string{"e", "a", "d", "c", "b"}
+	require.Equal(t, []string{"a", "d"}, Shard{Index: 1, Count: 3}.packages(pkgs))
+	require.Equal(t, []string{"b", "e"}, Shard{Index: 2, Count: 3}.packages(pkgs))
+	require.Equal(t, []string{"c"}, Shard{Index: 3, Count: 3}.packages(pkgs))
+}
+
+func TestBenchdiff_MergeShards(t *testing.T) {
+	dir := t.TempDir()
+	setupChangedRepo(t, dir)
+	testInDir(t, dir)
+	newDiffer := func(shard *Shard, shardFile string) *Benchdiff {
+		return &Benchdiff{
+			GitCmd:     "git",
+			BenchCmd:   "go",
+			ResultsDir: "./tmp",
+			BaseRef:    "HEAD",
+			Path:       ".",
+			Benchstat:  &benchstatter.Benchstat{},
+			Packages:   []string{"./..."},
+			PackageBenchArgs: func(pkg string) (string, error) {
+				return "test -bench . -count 2 -benchtime 10x " + pkg, nil
+			},
+			Shard:     shard,
+			ShardFile: shardFile,
+		}
+	}
+	shard1 := filepath.Join("tmp", "shard1.json")
+	shard2 := filepath.Join("tmp", "shard2.json")
+	result, err := newDiffer(&Shard{Index: 1, Count: 2}, shard1).Run()
+	require.NoError(t, err)
+	require.Equal(t, "go test -bench . -count 2 -benchtime 10x bindiff.test bindiff.test/other", result.benchCmd)
+	result, err = newDiffer(&Shard{Index: 2, Count: 2}, shard2).Run()
+	require.NoError(t, err)
+	require.Equal(t, "go test -bench . -count 2 -benchtime 10x bindiff.test/dep bindiff.test/testdep", result.benchCmd)
+
+	differ := newDiffer(nil, "")
+	_, err = differ.MergeShards(shard1)
+	require.EqualError(t, err, "missing shard 2/2")
+	_, err = differ.MergeShards(shard1, shard1)
+	require.Error(t, err)
+	merged, err := differ.MergeShards(shard2, shard1)
+	require.NoError(t, err)
+	require.Equal(t, result.headSHA, merged.headSHA)
+	require.Len(t, merged.tables[0].Rows, 4)
+	require.Empty(t, merged.AddedBenchmarks())
+	require.Empty(t, merged.RemovedBenchmarks())
+}
+
+func TestBenchdiff_MergeShards_removedPackage(t *testing.T) {
+	dir := t.TempDir()
+	setupChangedRepo(t, dir)
+	testInDir(t, dir)
+	// other only exists at base
+	mustGit(t, dir, "rm", "-r", "-q", "other")
+	newDiffer := func(shard *Shard, shardFile string) *Benchdiff {
+		return &Benchdiff{
+			GitCmd:     "git",
+			BenchCmd:   "go",
+			ResultsDir: "./tmp",
+			BaseRef:    "HEAD",
+			Path:       ".",
+			Benchstat:  &benchstatter.Benchstat{},
+			Packages:   []string{"./..."},
+			PackageBenchArgs: func(pkg string) (string, error) {
+				return "test -bench . -count 2 -benchtime 10x " + pkg, nil
+			},
+			Shard:     shard,
+			ShardFile: shardFile,
+		}
+	}
+	shard1 := filepath.Join("tmp", "shard1.json")
+	shard2 := filepath.Join("tmp", "shard2.json")
+	_, err := newDiffer(&Shard{Index: 1, Count: 2}, shard1).Run()
+	require.NoError(t, err)
+	_, err = newDiffer(&Shard{Index: 2, Count: 2}, shard2).Run()
+	require.NoError(t, err)
+	merged, err := newDiffer(nil, "").MergeShards(shard1, shard2)
+	require.NoError(t, err)
+	removed := merged.RemovedBenchmarks()
+	require.Len(t, removed, 1)
+	require.True(t, strings.HasPrefix(removed[0].Benchmark, "Other"), removed[0].Benchmark)
+}
+
+func TestBenchdiff_MergeShards_missingCommits(t *testing.T) {
+	// a shallow clone that doesn't have the commits the shards compared
+	dir := t.TempDir()
+	setupTestRepo(t, dir)
+	testInDir(t, dir)
+	data, err := json.Marshal(&shardFile{
+		Shard:       "1/1",
+		HeadSHA:     "1111111111111111111111111111111111111111",
+		BaseSHA:     "2222222222222222222222222222222222222222",
+		Packages:    []string{"bindiff.test"},
+		BaseResults: "pkg: bindiff.test\nBenchmarkFoo\t10\t100 ns/op\nBenchmarkFoo\t10\t100 ns/op\n",
+		HeadResults: "pkg: bindiff.test\nBenchmarkFoo\t10\t110 ns/op\nBenchmarkFoo\t10\t110 ns/op\n",
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile("shard.json", data, 0o600))
+	var debug bytes.Buffer
+	differ := &Benchdiff{
+		ResultsDir: "./tmp",
+		Path:       ".",
+		Benchstat:  &benchstatter.Benchstat{},
+		Debug:      log.New(&debug, "", 0),
+	}
+	merged, err := differ.MergeShards("shard.json")
+	require.NoError(t, err)
+	require.Len(t, merged.tables[0].Rows, 1)
+	require.Empty(t, merged.accepts)
+	require.Contains(t, debug.String(), "not reading Benchdiff-Accept trailers")
+}
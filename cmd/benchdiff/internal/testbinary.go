@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// testBinaryFlags are the go test flags that go test passes to the test binary as -test.<name>.
+// The value is true for flags that take a value.
+var testBinaryFlags = map[string]bool{
+	"bench": true, "benchmem": false, "benchtime": true, "blockprofile": true, "blockprofilerate": true,
+	"count": true, "coverprofile": true, "cpu": true, "cpuprofile": true, "failfast": false,
+	"fullpath": false, "fuzz": true, "fuzzminimizetime": true, "fuzztime": true, "list": true,
+	"memprofile": true, "memprofilerate": true, "mutexprofile": true, "mutexprofilefraction": true,
+	"outputdir": true, "parallel": true, "run": true, "short": false, "shuffle": true, "skip": true,
+	"timeout": true, "trace": true, "v": false,
+}
+
+// goTestFlags are the flags go test handles itself. The value is true for flags that take a value.
+var goTestFlags = map[string]bool{
+	"C": true, "a": false, "asan": false, "asmflags": true, "buildmode": true, "buildvcs": false,
+	"compiler": true, "cover": false, "covermode": true, "coverpkg": true, "exec": true,
+	"gccgoflags": true, "gcflags": true, "installsuffix": true, "json": false, "ldflags": true,
+	"linkshared": false, "mod": true, "modcacherw": false, "modfile": true, "msan": false, "n": false,
+	"overlay": true, "p": true, "pgo": true, "pkgdir": true, "race": false, "tags": true,
+	"toolexec": true, "trimpath": false, "vet": true, "work": false, "x": false,
+}
+
+// testBinaryArgs splits the arguments of a go test command after "test" into the flags for
+// building the test binary with go test -c and the flags for running it. Package arguments and
+// the go test flags that only affect how go test runs the binary are dropped. Flags after -args
+// and flags go test doesn't know are passed to the binary unchanged. count is the value of -count.
+func testBinaryArgs(args []string) (buildFlags, runFlags []string, count int, err error) {
+	count = 1
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" || arg == "--args" {
+			runFlags = append(runFlags, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			// a package
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		value, hasValue := "", false
+		if eq := strings.IndexByte(name, '='); eq != -1 {
+			name, value, hasValue = name[:eq], name[eq+1:], true
+		}
+		name = strings.TrimPrefix(name, "test.")
+		takesValue, isTestFlag := testBinaryFlags[name]
+		buildTakesValue, isBuildFlag := goTestFlags[name]
+		if !isTestFlag && !isBuildFlag {
+			runFlags = append(runFlags, arg)
+			continue
+		}
+		if (takesValue || buildTakesValue) && !hasValue {
+			if i+1 == len(args) {
+				return nil, nil, 0, fmt.Errorf("flag -%s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		switch {
+		case name == "C":
+			return nil, nil, 0, fmt.Errorf("flag -C isn't supported when running test binaries")
+		case name == "count":
+			count, err = strconv.Atoi(value)
+			if err != nil || count < 0 {
+				return nil, nil, 0, fmt.Errorf("invalid -count %q", value)
+			}
+		case name == "json" || name == "vet" || name == "exec":
+			// json is handled by runTestBinary. vet and exec only affect how go test runs the binary.
+		case isBuildFlag && (buildTakesValue || hasValue):
+			buildFlags = append(buildFlags, "-"+name+"="+value)
+		case isBuildFlag:
+			buildFlags = append(buildFlags, "-"+name)
+		case takesValue || hasValue:
+			runFlags = append(runFlags, "-test."+name+"="+value)
+		default:
+			runFlags = append(runFlags, "-test."+name)
+		}
+	}
+	return buildFlags, runFlags, count, nil
+}
+
+// runTestBinary builds pkg's test binary with cmd's go executable, directory and environment and
+// runs it once for each -count in args, the arguments of a go test command. Measuring the binary
+// instead of go test keeps the compiler and linker out of the resource usage. Output from the
+// runs is written to stdout in the format go test would write it. It returns the resource usage
+// of each run that reported it. The result and error are from the first command that failed.
+func (c *Benchdiff) runTestBinary(cmd *Command, pkg *listedPackage, args string, side *WrapperData, stdout, stderr io.Writer) ([]*ResourceUsage, *CommandResult, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || fields[0] != "test" {
+		return nil, nil, fmt.Errorf("resource usage requires go test arguments, got %q", args)
+	}
+	buildFlags, runFlags, count, err := testBinaryArgs(fields[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	binDir, err := os.MkdirTemp("", "benchdiff-test")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		rErr := os.RemoveAll(binDir)
+		if rErr != nil {
+			c.debug().Printf("could not delete temp directory %s: %v", binDir, rErr)
+		}
+	}()
+	binary := filepath.Join(binDir, filepath.Base(pkg.ImportPath)+".test")
+	buildArgs := append(append([]string{"test", "-c", "-o", binary}, buildFlags...), pkg.ImportPath)
+	buildCmd := NewCommand(cmd.Path, buildArgs...)
+	buildCmd.Dir = cmd.Dir
+	buildCmd.Env = cmd.Env
+	buildCmd.Stderr = stderr
+	result, err := runCmd(c.runner(), buildCmd, c.debug())
+	if err != nil {
+		return nil, result, err
+	}
+	if !fileExists(binary) {
+		// go test -c doesn't write a binary for packages without test files
+		return nil, result, nil
+	}
+	if c.TestJSON {
+		runFlags = append(runFlags, "-test.v=test2json")
+	}
+	var usages []*ResourceUsage
+	for i := 0; i < count; i++ {
+		var output bytes.Buffer
+		// go test runs test binaries in the package's directory
+		binCmd := NewCommand(binary, append(append([]string{}, runFlags...), "-test.count=1")...)
+		binCmd.Dir = pkg.Dir
+		binCmd.Env = cmd.Env
+		binCmd.Stdout = &output
+		binCmd.Stderr = stderr
+		var runErr error
+		result, runErr = c.runWrapped(binCmd, side)
+		if result == nil {
+			return nil, nil, runErr
+		}
+		if result.Usage != nil {
+			usages = append(usages, result.Usage)
+		}
+		err = c.writeTestOutput(cmd, pkg.ImportPath, &output, stdout)
+		if err != nil {
+			return nil, nil, err
+		}
+		if runErr != nil {
+			return usages, result, runErr
+		}
+	}
+	return usages, result, nil
+}
+
+// writeTestOutput writes the output of a test binary to w. With c.TestJSON it is converted to
+// the go test -json format with go tool test2json.
+func (c *Benchdiff) writeTestOutput(cmd *Command, pkg string, output io.Reader, w io.Writer) error {
+	if !c.TestJSON {
+		_, err := io.Copy(w, output)
+		return err
+	}
+	convertCmd := NewCommand(cmd.Path, "tool", "test2json", "-t", "-p", pkg)
+	convertCmd.Dir = cmd.Dir
+	convertCmd.Env = cmd.Env
+	convertCmd.Stdin = output
+	convertCmd.Stdout = w
+	_, err := runCmd(c.runner(), convertCmd, c.debug())
+	return err
+}
@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_testBinaryArgs(t *testing.T) {
+	args := "./foo -run '^$' -bench=. -count 5 -benchtime 10x -benchmem -tags integration -race -json -cpu 1,4 -vet=off -args -custom 1"
+	buildFlags, runFlags, count, err := testBinaryArgs(strings.Fields(args))
+	require.NoError(t, err)
+	require.Equal(t, []string{"-tags=integration", "-race"}, buildFlags)
+	require.Equal(t, []string{
+		"-test.run='^$'", "-test.bench=.", "-test.benchtime=10x", "-test.benchmem", "-test.cpu=1,4", "-custom", "1",
+	}, runFlags)
+	require.Equal(t, 5, count)
+
+	// the last -count wins like it does for go test
+	_, _, count, err = testBinaryArgs(strings.Fields("-count 5 ./... -count 1"))
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	_, runFlags, count, err = testBinaryArgs(strings.Fields("-test.bench . -unknown=x"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"-test.bench=.", "-unknown=x"}, runFlags)
+	require.Equal(t, 1, count)
+
+	for _, args := range []string{"-bench", "-count x", "-C dir"} {
+		_, _, _, err = testBinaryArgs(strings.Fields(args))
+		require.Error(t, err, args)
+	}
+}
@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// testEvent is the subset of a "go test -json" event that benchdiff uses. See "go doc test2json".
+type testEvent struct {
+	Action     string
+	Package    string
+	Test       string
+	Output     string
+	ImportPath string // set on build-output events
+}
+
+var (
+	benchResultRegexp = regexp.MustCompile(`^Benchmark\S*\s+\d+\s+\S+ \S+`)
+	configLineRegexp  = regexp.MustCompile(`^[a-z][^\s:]*: `)
+)
+
+// testJSONOutput is the output of "go test -json" sorted into benchmark results and everything else.
+type testJSONOutput struct {
+	results  bytes.Buffer             // benchmark results and configuration lines in the benchmark format
+	logs     map[string]*bytes.Buffer // all other output by package. Output that isn't a test event is under "".
+	failures []Failure
+}
+
+func (o *testJSONOutput) log(pkg, line string) {
+	if o.logs[pkg] == nil {
+		o.logs[pkg] = &bytes.Buffer{}
+	}
+	o.logs[pkg].WriteString(line)
+}
+
+// testJSONState tracks a running package or benchmark while reading test events.
+type testJSONState struct {
+	logs  []string // indented log lines of a benchmark
+	panic string   // the panic line when a benchmark panicked
+}
+
+// parseTestJSON sorts the output of "go test -json" into benchmark results, logs and failures.
+func parseTestJSON(output []byte, side string) *testJSONOutput {
+	parsed := &testJSONOutput{
+		logs: map[string]*bytes.Buffer{},
+	}
+	states := map[[2]string]*testJSONState{}
+	state := func(pkg, test string) *testJSONState {
+		key := [2]string{pkg, test}
+		if states[key] == nil {
+			states[key] = &testJSONState{}
+		}
+		return states[key]
+	}
+	// partials are the lines of output by package that haven't ended yet. A line can start in an
+	// event with Test set and end in one without it.
+	partials := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var event testEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil || event.Action == "" {
+			parsed.log("", scanner.Text()+"\n")
+			continue
+		}
+		st := state(event.Package, event.Test)
+		switch event.Action {
+		case "build-output":
+			pkg, _, _ := strings.Cut(event.ImportPath, " ")
+			parsed.log(pkg, event.Output)
+		case "run":
+			st.logs = nil
+			st.panic = ""
+		case "output":
+			text := partials[event.Package] + event.Output
+			delete(partials, event.Package)
+			for text != "" {
+				i := strings.IndexByte(text, '\n')
+				if i == -1 {
+					partials[event.Package] = text
+					break
+				}
+				parsed.addLine(event.Package, event.Test, text[:i+1], st)
+				text = text[i+1:]
+			}
+		case "fail":
+			if partial := partials[event.Package]; partial != "" {
+				parsed.addLine(event.Package, event.Test, partial+"\n", st)
+				delete(partials, event.Package)
+			}
+			if event.Test != "" {
+				parsed.failures = append(parsed.failures, Failure{
+					Side:      side,
+					Package:   event.Package,
+					Benchmark: event.Test,
+					Reason:    strings.Join(st.logs, "\n"),
+				})
+				continue
+			}
+			// a benchmark that panics takes the test binary down without a fail event of its own
+			for key, testState := range states {
+				if key[0] != event.Package || key[1] == "" || testState.panic == "" {
+					continue
+				}
+				parsed.failures = append(parsed.failures, Failure{
+					Side:      side,
+					Package:   event.Package,
+					Benchmark: key[1],
+					Panic:     true,
+					Reason:    testState.panic,
+				})
+				testState.panic = ""
+			}
+		}
+	}
+	return parsed
+}
+
+func (o *testJSONOutput) addLine(pkg, test, line string, st *testJSONState) {
+	trimmed := strings.TrimSuffix(line, "\n")
+	switch {
+	case test == "" && configLineRegexp.MatchString(trimmed):
+		o.results.WriteString(line)
+		return
+	case benchResultRegexp.MatchString(trimmed):
+		// with -count > 1 only the first result of a benchmark has its Test set
+		o.results.WriteString(line)
+		return
+	case test != "" && st.panic == "" && strings.HasPrefix(trimmed, "panic: "):
+		st.panic = trimmed
+	case test != "" && strings.HasPrefix(trimmed, "    "):
+		st.logs = append(st.logs, strings.TrimSpace(trimmed))
+	}
+	o.log(pkg, line)
+}
+
+// benchOutput writes the benchmark results in output to w and returns the benchmark failures it
+// finds. With c.TestJSON, output is "go test -json" events and everything that isn't a benchmark
+// result is written to log files in logDir. Logs are discarded when logDir is empty.
+func (c *Benchdiff) benchOutput(output []byte, w io.Writer, side, logDir string) ([]Failure, error) {
+	if w == nil {
+		w = io.Discard
+	}
+	if !c.TestJSON {
+		_, err := w.Write(output)
+		if err != nil {
+			return nil, err
+		}
+		return parseBenchmarkFailures(output, side), nil
+	}
+	parsed := parseTestJSON(output, side)
+	if logDir != "" {
+		err := writeTestLogs(logDir, parsed.logs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := w.Write(parsed.results.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return parsed.failures, nil
+}
+
+// testLogsDir returns the directory where package logs for the benchmark output in filename are kept.
+func testLogsDir(filename string) string {
+	return strings.TrimSuffix(filename, ".out") + ".logs"
+}
+
+// testLogFilename returns the name of the log file for pkg.
+func testLogFilename(pkg string) string {
+	if pkg == "" {
+		return "output.log"
+	}
+	return strings.ReplaceAll(pkg, "/", "_") + ".log"
+}
+
+// writeTestLogs appends each package's logs to its log file in dir.
+func writeTestLogs(dir string, logs map[string]*bytes.Buffer) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return err
+	}
+	for pkg, buf := range logs {
+		var f *os.File
+		f, err = os.OpenFile(filepath.Join(dir, testLogFilename(pkg)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o666)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
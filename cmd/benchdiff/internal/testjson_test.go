@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseTestJSON(t *testing.T) {
+	// go test -json -run '^$' -bench . -count 3 -benchtime 10x -benchmem
+	output, err := os.ReadFile(filepath.Join("testdata", "count3.json"))
+	require.NoError(t, err)
+	got := parseTestJSON(output, SideBase)
+	require.Equal(t, `goos: linux
+goarch: amd64
+pkg: example.com/tj
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkFoo 	      10	        24.10 ns/op	       0 B/op	       0 allocs/op
+BenchmarkFoo 	      10	        12.50 ns/op	       0 B/op	       0 allocs/op
+BenchmarkFoo 	      10	        12.70 ns/op	       0 B/op	       0 allocs/op
+BenchmarkLog 	      10	      3049 ns/op	      93 B/op	       1 allocs/op
+BenchmarkLog 	      10	      2557 ns/op	      93 B/op	       1 allocs/op
+BenchmarkLog 	      10	      3063 ns/op	      93 B/op	       1 allocs/op
+`, got.results.String())
+	require.Empty(t, got.failures)
+	require.NotContains(t, got.logs["example.com/tj"].String(), "ns/op")
+	require.Contains(t, got.logs["example.com/tj"].String(), "tj_test.go:11: hello\n")
+}
+
+func Test_parseTestJSON_failures(t *testing.T) {
+	// go test -json -run '^$' -bench . -count 2 -benchtime 10x ./a ./b
+	output, err := os.ReadFile(filepath.Join("testdata", "failures.json"))
+	require.NoError(t, err)
+	output = append(output, "not json\n"...)
+	got := parseTestJSON(output, SideBase)
+	require.Equal(t, `goos: linux
+goarch: amd64
+pkg: x/a
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkLog   	      10	      2573 ns/op
+BenchmarkLog   	      10	      1774 ns/op
+goos: linux
+goarch: amd64
+pkg: x/b
+cpu: Intel(R) Xeon(R) Processor
+`, got.results.String())
+	require.Equal(t, []Failure{
+		{
+			Side:      SideBase,
+			Package:   "x/a",
+			Benchmark: "BenchmarkFails",
+			Reason:    "a_test.go:16: oops",
+		},
+		{
+			Side:      SideBase,
+			Package:   "x/b",
+			Benchmark: "BenchmarkPanics",
+			Panic:     true,
+			Reason:    "panic: assignment to entry in nil map",
+		},
+	}, got.failures)
+	require.Equal(t, `=== RUN   BenchmarkLog
+BenchmarkLog
+    a_test.go:9: hello
+stdout chatter
+    a_test.go:9: hello
+stdout chatter
+    a_test.go:9: hello
+stdout chatter
+    a_test.go:9: hello
+stdout chatter
+=== RUN   BenchmarkFails
+BenchmarkFails
+    a_test.go:16: oops
+--- FAIL: BenchmarkFails
+FAIL
+exit status 1
+FAIL	x/a	0.005s
+`, got.logs["x/a"].String())
+	require.Equal(t, "not json\n", got.logs[""].String())
+}
+
+func Test_writeTestLogs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	parsed := parseTestJSON([]byte(`{"Action":"output","Package":"x/a","Output":"hello\n"}`), SideHead)
+	err := writeTestLogs(dir, parsed.logs)
+	require.NoError(t, err)
+	err = writeTestLogs(dir, parsed.logs)
+	require.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join(dir, "x_a.log"))
+	require.NoError(t, err)
+	require.Equal(t, "hello\nhello\n", string(got))
+}
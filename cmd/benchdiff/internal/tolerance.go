@@ -0,0 +1,319 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ToleranceRule sets the tolerance for benchmarks that match it. The first matching rule applies.
+type ToleranceRule struct {
+	// Pattern is matched against the full benchmark name, including the "Benchmark" prefix but
+	// without the GOMAXPROCS suffix. For example "BenchmarkParse/small". nil matches every benchmark.
+	Pattern *regexp.Regexp
+
+	// Metric limits the rule to one benchstat table like "time/op" or "allocs/op". "" matches every metric.
+	// Units are accepted too, so "ns/op" is the same as "time/op".
+	Metric string
+
+	// Tolerance is the minimum percent change before a result is considered degraded.
+	Tolerance float64
+
+	// Ignore means matching results are never considered degraded.
+	Ignore bool
+
+	// Source is the rule as it was written. It is shown in reports.
+	Source string
+}
+
+const globPrefix = "glob:"
+
+// ParseToleranceRule parses a ToleranceRule from a string in the form "pattern[@metric]=tolerance"
+// or "pattern[@metric]=ignore". pattern is a regular expression or a glob prefixed with "glob:".
+func ParseToleranceRule(s string) (ToleranceRule, error) {
+	i := strings.LastIndex(s, "=")
+	if i == -1 {
+		return ToleranceRule{}, fmt.Errorf("invalid tolerance rule %q: missing %q", s, "=")
+	}
+	pattern, value := s[:i], s[i+1:]
+	rule := ToleranceRule{Source: s}
+	var err error
+	rule.Pattern, rule.Metric, err = parseBenchmarkPattern(pattern)
+	if err != nil {
+		return ToleranceRule{}, fmt.Errorf("invalid tolerance rule %q: %v", s, err)
+	}
+	err = rule.parseTolerance(value)
+	if err != nil {
+		return ToleranceRule{}, fmt.Errorf("invalid tolerance rule %q: %v", s, err)
+	}
+	return rule, nil
+}
+
+// parseBenchmarkPattern parses "pattern[@metric]" where pattern is a regular expression or a glob
+// prefixed with "glob:"
+func parseBenchmarkPattern(s string) (*regexp.Regexp, string, error) {
+	var metric string
+	if i := strings.LastIndex(s, "@"); i != -1 {
+		s, metric = s[:i], MetricName(s[i+1:])
+	}
+	if strings.HasPrefix(s, globPrefix) {
+		re, err := globRegexp(strings.TrimPrefix(s, globPrefix))
+		return re, metric, err
+	}
+	re, err := regexp.Compile(s)
+	return re, metric, err
+}
+
+// ParseMetricTolerance parses a ToleranceRule for every benchmark in one metric from a string in the
+// form "metric=tolerance" or "metric=ignore".
+func ParseMetricTolerance(s string) (ToleranceRule, error) {
+	metric, value, err := parseMetricOption(s)
+	if err != nil {
+		return ToleranceRule{}, fmt.Errorf("invalid metric tolerance %q: %v", s, err)
+	}
+	rule := ToleranceRule{
+		Metric: metric,
+		Source: s,
+	}
+	err = rule.parseTolerance(value)
+	if err != nil {
+		return ToleranceRule{}, fmt.Errorf("invalid metric tolerance %q: %v", s, err)
+	}
+	return rule, nil
+}
+
+func (r *ToleranceRule) parseTolerance(value string) error {
+	if value == "ignore" {
+		r.Ignore = true
+		return nil
+	}
+	var err error
+	r.Tolerance, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return fmt.Errorf("tolerance must be a number or %q", "ignore")
+	}
+	return nil
+}
+
+// ParseMetricExitCode parses the exit code for degraded results in one metric from a string in the
+// form "metric=code".
+func ParseMetricExitCode(s string) (string, int, error) {
+	metric, value, err := parseMetricOption(s)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid metric exit code %q: %v", s, err)
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid metric exit code %q: exit code must be an integer", s)
+	}
+	return metric, code, nil
+}
+
+// parseMetricOption splits "metric=value" and returns the benchstat metric name
+func parseMetricOption(s string) (metric, value string, err error) {
+	metric, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return "", "", fmt.Errorf("missing %q", "=")
+	}
+	if metric == "" {
+		return "", "", fmt.Errorf("missing metric")
+	}
+	return MetricName(metric), value, nil
+}
+
+// metricUnits maps the units benchstat renames to the metric names it uses as table headers
+var metricUnits = map[string]string{
+	"ns/op": "time/op",
+	"ns/GC": "time/GC",
+	"B/op":  "alloc/op",
+	"MB/s":  "speed",
+}
+
+// MetricName returns the benchstat metric name for unit, which may already be a metric name. Units
+// that benchstat doesn't rename, like allocs/op and units from b.ReportMetric, are their own metric names.
+func MetricName(unit string) string {
+	if metric, ok := metricUnits[unit]; ok {
+		return metric
+	}
+	return unit
+}
+
+// globRegexp converts a glob as understood by path.Match to a regexp matching the whole name.
+// Unlike path.Match, * matches across "/" so "BenchmarkIO*" matches sub-benchmarks.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	_, err := path.Match(glob, "")
+	if err != nil {
+		return nil, err
+	}
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; ch {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		case '[':
+			j := strings.IndexByte(glob[i:], ']') + i
+			class := glob[i+1 : j]
+			if strings.HasPrefix(class, "^") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i = j
+		case '\\':
+			i++
+			if i < len(glob) {
+				re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+func (r *ToleranceRule) matches(benchmark, metric string) bool {
+	if r.Metric != "" && r.Metric != metric {
+		return false
+	}
+	return r.Pattern == nil || r.Pattern.MatchString(benchmark)
+}
+
+// DegradeOptions decides which rows of a RunResult are degraded
+type DegradeOptions struct {
+	Tolerance float64         // the minimum percent change for rows that don't match a rule
+	Rules     []ToleranceRule // the first matching rule overrides Tolerance
+
+	// MinDeltas is the minimum absolute change by metric, in the metric's unit. For example
+	// {"time/op": 100} ignores time degradations of 100ns/op or less.
+	MinDeltas map[string]float64
+
+	// GeomeanTolerances is the tolerance for the geomean of each metric. See RunResult.GeomeanResults.
+	GeomeanTolerances map[string]float64
+}
+
+// DegradedRow is a row with a statistically significant degradation larger than its tolerance and minimum delta
+type DegradedRow struct {
+	ComparedRow
+	Tolerance float64 `json:"tolerance"`
+	MinDelta  float64 `json:"min_delta,omitempty"`
+	Rule      string  `json:"rule,omitempty"`     // the ToleranceRule that set Tolerance. "" for the default tolerance
+	Accept    *Accept `json:"accepted,omitempty"` // the Benchdiff-Accept trailer that accepted the row, if any
+}
+
+func (d DegradedRow) String() string {
+	s := fmt.Sprintf("%s %s %+.2f%%", d.Benchmark, d.Metric, d.PctDelta)
+	if d.CI != nil {
+		s += " " + d.CI.String()
+	}
+	if d.Group == "" {
+		return s
+	}
+	return d.Group + " " + s
+}
+
+// ruleBenchmarkName returns the name ToleranceRule patterns are matched against for a benchstat
+// benchmark run with one of procs as GOMAXPROCS
+func ruleBenchmarkName(benchmark string, procs []int) string {
+	return "Benchmark" + strings.TrimSuffix(benchmark, procsSuffix(benchmark, procs))
+}
+
+// DegradedRows returns rows with DegradingChange, a PctDelta magnitude over the tolerance of the
+// first matching rule, or over opts.Tolerance when no rule matches, and an absolute change over the
+// metric's minimum delta. With a tolerance of 0 any significant degradation counts. Degraded
+// geomeans from opts.GeomeanTolerances come last. Rows accepted by a Benchdiff-Accept trailer are
+// left out. See AcceptedRows.
+func (r *RunResult) DegradedRows(opts *DegradeOptions) []DegradedRow {
+	degraded, _ := r.degradedRows(opts)
+	return degraded
+}
+
+// AcceptedRows returns the rows DegradedRows would return if a Benchdiff-Accept trailer from a commit
+// between base and head didn't match them
+func (r *RunResult) AcceptedRows(opts *DegradeOptions) []DegradedRow {
+	_, accepted := r.degradedRows(opts)
+	return accepted
+}
+
+func (r *RunResult) degradedRows(opts *DegradeOptions) (degraded, accepted []DegradedRow) {
+	if opts == nil {
+		opts = &DegradeOptions{}
+	}
+	for _, row := range r.Rows() {
+		if row.Change != DegradingChange {
+			continue
+		}
+		d := DegradedRow{
+			ComparedRow: row,
+			Tolerance:   opts.Tolerance,
+			MinDelta:    opts.MinDeltas[row.Metric],
+		}
+		ignore := false
+		name := ruleBenchmarkName(row.Benchmark, r.procs)
+		for i := range opts.Rules {
+			if opts.Rules[i].matches(name, row.Metric) {
+				d.Tolerance = opts.Rules[i].Tolerance
+				d.Rule = opts.Rules[i].Source
+				ignore = opts.Rules[i].Ignore
+				break
+			}
+		}
+		if ignore || math.Abs(d.PctDelta) <= d.Tolerance || math.Abs(d.Delta()) <= d.MinDelta {
+			continue
+		}
+		for i := range r.accepts {
+			if r.accepts[i].matches(name, row.Metric) {
+				d.Accept = &r.accepts[i]
+				break
+			}
+		}
+		if d.Accept != nil {
+			accepted = append(accepted, d)
+			continue
+		}
+		degraded = append(degraded, d)
+	}
+	for _, g := range r.GeomeanResults(opts.GeomeanTolerances) {
+		if g.Degraded {
+			degraded = append(degraded, DegradedRow{
+				ComparedRow: g.ComparedRow,
+				Tolerance:   g.Tolerance,
+			})
+		}
+	}
+	return degraded, accepted
+}
+
+// ParseMetricMinDelta parses the minimum absolute change for one metric from a string in the form
+// "metric=delta". The delta is in the metric's unit.
+func ParseMetricMinDelta(s string) (string, float64, error) {
+	metric, value, err := parseMetricOption(s)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid metric minimum delta %q: %v", s, err)
+	}
+	delta, err := strconv.ParseFloat(value, 64)
+	if err != nil || delta < 0 {
+		return "", 0, fmt.Errorf("invalid metric minimum delta %q: delta must be a non-negative number", s)
+	}
+	return metric, delta, nil
+}
+
+// DegradeExitCode returns the exit code for degraded rows. It is the first non-zero code from
+// metricCodes, using onDegrade for metrics without a code.
+func DegradeExitCode(degraded []DegradedRow, onDegrade int, metricCodes map[string]int) int {
+	for _, row := range degraded {
+		code, ok := metricCodes[row.Metric]
+		if !ok {
+			code = onDegrade
+		}
+		if code != 0 {
+			return code
+		}
+	}
+	return 0
+}
@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/perf/benchstat"
+)
+
+func TestParseToleranceRule(t *testing.T) {
+	rule, err := ParseToleranceRule(`^BenchmarkIO/=25`)
+	require.NoError(t, err)
+	require.Equal(t, `^BenchmarkIO/`, rule.Pattern.String())
+	require.Equal(t, "", rule.Metric)
+	require.Equal(t, 25.0, rule.Tolerance)
+	require.False(t, rule.Ignore)
+	require.Equal(t, `^BenchmarkIO/=25`, rule.Source)
+
+	rule, err = ParseToleranceRule(`glob:BenchmarkMicro*@time/op=3%`)
+	require.NoError(t, err)
+	require.Equal(t, `^BenchmarkMicro.*$`, rule.Pattern.String())
+	require.Equal(t, "time/op", rule.Metric)
+	require.Equal(t, 3.0, rule.Tolerance)
+
+	rule, err = ParseToleranceRule(`Flaky=ignore`)
+	require.NoError(t, err)
+	require.True(t, rule.Ignore)
+
+	_, err = ParseToleranceRule(`BenchmarkIO`)
+	require.EqualError(t, err, `invalid tolerance rule "BenchmarkIO": missing "="`)
+
+	_, err = ParseToleranceRule(`BenchmarkIO=lots`)
+	require.EqualError(t, err, `invalid tolerance rule "BenchmarkIO=lots": tolerance must be a number or "ignore"`)
+
+	_, err = ParseToleranceRule(`(=1`)
+	require.Error(t, err)
+
+	_, err = ParseToleranceRule(`glob:[=1`)
+	require.Error(t, err)
+}
+
+func Test_globRegexp(t *testing.T) {
+	for glob, want := range map[string]string{
+		`BenchmarkIO*`:     `^BenchmarkIO.*$`,
+		`Benchmark?/a.b`:   `^Benchmark./a\.b$`,
+		`Benchmark[^ab]x`:  `^Benchmark[^ab]x$`,
+		`Benchmark\*`:      `^Benchmark\*$`,
+		`Benchmark[a-c]/*`: `^Benchmark[a-c]/.*$`,
+	} {
+		re, err := globRegexp(glob)
+		require.NoError(t, err)
+		require.Equal(t, want, re.String(), glob)
+	}
+}
+
+func TestRunResult_DegradedRows(t *testing.T) {
+	var rules []ToleranceRule
+	for _, s := range []string{
+		`glob:BenchmarkMicro*=3`,
+		`^BenchmarkIO/=25`,
+		`^BenchmarkFlaky$=ignore`,
+		`@alloc/op=50`,
+	} {
+		rule, err := ParseToleranceRule(s)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	result := &RunResult{
+		procs: []int{8},
+		tables: []*benchstat.Table{
+			{
+				Metric: "time/op",
+				Rows: []*benchstat.Row{
+					testRow("MicroAdd-8", 4, DegradingChange),
+					testRow("MicroSub-8", 2, DegradingChange),
+					testRow("IO/read-8", 20, DegradingChange),
+					testRow("IO/write-8", 30, DegradingChange),
+					testRow("Flaky-8", 90, DegradingChange),
+					testRow("Other-8", 11, DegradingChange),
+					testRow("Faster-8", -50, ImprovingChange),
+					testRow("Noisy-8", 40, InsignificantChange),
+				},
+			},
+			{
+				Metric: "alloc/op",
+				Rows: []*benchstat.Row{
+					testRow("Other-8", 40, DegradingChange),
+				},
+			},
+		},
+	}
+	require.Equal(t, []DegradedRow{
+		testDegraded("MicroAdd-8", "time/op", 4, 3, `glob:BenchmarkMicro*=3`),
+		testDegraded("IO/write-8", "time/op", 30, 25, `^BenchmarkIO/=25`),
+		testDegraded("Other-8", "time/op", 11, 10, ""),
+	}, result.DegradedRows(&DegradeOptions{Tolerance: 10, Rules: rules}))
+	require.True(t, result.HasDegradedResult(10, rules...))
+	require.False(t, result.HasDegradedResult(90, rules[2:]...))
+}
+
+func TestParseMetricTolerance(t *testing.T) {
+	rule, err := ParseMetricTolerance(`allocs/op=0`)
+	require.NoError(t, err)
+	require.Nil(t, rule.Pattern)
+	require.Equal(t, "allocs/op", rule.Metric)
+	require.Equal(t, 0.0, rule.Tolerance)
+
+	rule, err = ParseMetricTolerance(`B/op=5`)
+	require.NoError(t, err)
+	require.Equal(t, "alloc/op", rule.Metric)
+	require.Equal(t, 5.0, rule.Tolerance)
+
+	rule, err = ParseMetricTolerance(`items/s=ignore`)
+	require.NoError(t, err)
+	require.Equal(t, "items/s", rule.Metric)
+	require.True(t, rule.Ignore)
+
+	_, err = ParseMetricTolerance(`=5`)
+	require.EqualError(t, err, `invalid metric tolerance "=5": missing metric`)
+
+	_, err = ParseMetricTolerance(`ns/op`)
+	require.EqualError(t, err, `invalid metric tolerance "ns/op": missing "="`)
+}
+
+func TestParseMetricExitCode(t *testing.T) {
+	metric, code, err := ParseMetricExitCode(`ns/op=2`)
+	require.NoError(t, err)
+	require.Equal(t, "time/op", metric)
+	require.Equal(t, 2, code)
+
+	_, _, err = ParseMetricExitCode(`allocs/op=x`)
+	require.EqualError(t, err, `invalid metric exit code "allocs/op=x": exit code must be an integer`)
+}
+
+func TestRunResult_DegradedRows_metrics(t *testing.T) {
+	var rules []ToleranceRule
+	rule, err := ParseToleranceRule(`^BenchmarkIO$@time/op=25`)
+	require.NoError(t, err)
+	rules = append(rules, rule)
+	for _, s := range []string{`allocs/op=0`, `MB/s=5`, `items/op=ignore`} {
+		rule, err = ParseMetricTolerance(s)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	result := &RunResult{
+		procs: []int{8},
+		tables: []*benchstat.Table{
+			{
+				Metric: "time/op",
+				Rows: []*benchstat.Row{
+					testRow("IO-8", 20, DegradingChange),
+					testRow("Parse-8", 8, DegradingChange),
+				},
+			},
+			{
+				Metric: "speed",
+				Rows: []*benchstat.Row{
+					testRow("IO-8", -6, DegradingChange),
+				},
+			},
+			{
+				Metric: "allocs/op",
+				Rows: []*benchstat.Row{
+					testRow("IO-8", 0.5, DegradingChange),
+				},
+			},
+			{
+				Metric: "items/op",
+				Rows: []*benchstat.Row{
+					testRow("Parse-8", 300, DegradingChange),
+				},
+			},
+		},
+	}
+	degraded := result.DegradedRows(&DegradeOptions{Tolerance: 10, Rules: rules})
+	require.Equal(t, []DegradedRow{
+		testDegraded("IO-8", "speed", -6, 5, `MB/s=5`),
+		testDegraded("IO-8", "allocs/op", 0.5, 0, `allocs/op=0`),
+	}, degraded)
+
+	require.Equal(t, 1, DegradeExitCode(degraded, 1, nil))
+	require.Equal(t, 3, DegradeExitCode(degraded, 1, map[string]int{"speed": 0, "allocs/op": 3}))
+	require.Equal(t, 0, DegradeExitCode(degraded, 0, map[string]int{"time/op": 2}))
+}
+
+func TestRunResult_HasDegradedResult_speed(t *testing.T) {
+	// a speed degrades when it goes down, and the size of the drop is compared with the tolerance
+	result := &RunResult{
+		tables: []*benchstat.Table{
+			{
+				Metric: "speed",
+				Rows: []*benchstat.Row{
+					testRow("Read-8", -15, DegradingChange),
+					testRow("Write-8", 30, ImprovingChange),
+				},
+			},
+		},
+	}
+	require.True(t, result.HasDegradedResult(10))
+	require.False(t, result.HasDegradedResult(20))
+}
+
+// testRow returns a benchstat row where the old mean is 100 and the new mean is pct higher
+func testRow(benchmark string, pct float64, change int) *benchstat.Row {
+	return &benchstat.Row{
+		Benchmark: benchmark,
+		Metrics: []*benchstat.Metrics{
+			{Unit: "ns/op", Mean: 100},
+			{Unit: "ns/op", Mean: 100 + pct},
+		},
+		PctDelta: pct,
+		Change:   change,
+	}
+}
+
+// testDegraded returns the DegradedRow for a row from testRow
+func testDegraded(benchmark, metric string, pct, tolerance float64, rule string) DegradedRow {
+	return DegradedRow{
+		ComparedRow: ComparedRow{
+			Benchmark: benchmark,
+			Metric:    metric,
+			Unit:      "ns/op",
+			Old:       100,
+			New:       100 + pct,
+			PctDelta:  pct,
+			Change:    DegradingChange,
+		},
+		Tolerance: tolerance,
+		Rule:      rule,
+	}
+}
+
+func TestParseMetricMinDelta(t *testing.T) {
+	metric, delta, err := ParseMetricMinDelta(`ns/op=100`)
+	require.NoError(t, err)
+	require.Equal(t, "time/op", metric)
+	require.Equal(t, 100.0, delta)
+
+	_, _, err = ParseMetricMinDelta(`allocs/op=-1`)
+	require.EqualError(t, err, `invalid metric minimum delta "allocs/op=-1": delta must be a non-negative number`)
+}
+
+func Test_ruleBenchmarkName(t *testing.T) {
+	procs := []int{8}
+	require.Equal(t, "BenchmarkSize-1024", ruleBenchmarkName("Size-1024", procs))
+	require.Equal(t, "BenchmarkSize-1024", ruleBenchmarkName("Size-1024-8", procs))
+	require.Equal(t, "BenchmarkSize", ruleBenchmarkName("Size-8", procs))
+	require.Equal(t, "BenchmarkSize-4", ruleBenchmarkName("Size-4", procs))
+}
+
+func TestRunResult_DegradedRows_minDeltas(t *testing.T) {
+	result := &RunResult{
+		tables: []*benchstat.Table{
+			{
+				Metric: "time/op",
+				Rows: []*benchstat.Row{
+					testRow("Tiny-8", 50, DegradingChange),
+					testRow("Big-8", 150, DegradingChange),
+				},
+			},
+		},
+	}
+	degraded := result.DegradedRows(&DegradeOptions{
+		Tolerance: 10,
+		MinDeltas: map[string]float64{"time/op": 100},
+	})
+	want := testDegraded("Big-8", "time/op", 150, 10, "")
+	want.MinDelta = 100
+	require.Equal(t, []DegradedRow{want}, degraded)
+	require.Equal(t, 150.0, degraded[0].Delta())
+	require.Len(t, result.DegradedRows(&DegradeOptions{Tolerance: 10}), 2)
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+)
+
+// Side names used in WrapperData
+const (
+	SideWarmup = "warmup"
+	SideBase   = "base"
+	SideHead   = "head"
+)
+
+// WrapperData is the data available to the Wrapper template
+type WrapperData struct {
+	Side     string // one of SideWarmup, SideBase or SideHead
+	Ref      string // the git ref being run. empty for the head worktree
+	Worktree string // path to the worktree being run
+}
+
+func (d *WrapperData) warmup() bool {
+	return d.Side == SideWarmup
+}
+
+// wrapperFuncs are the functions available to the Wrapper template
+var wrapperFuncs = template.FuncMap{
+	// quote quotes s as a single argument, for example a worktree path with spaces
+	"quote": func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	},
+}
+
+// wrapCmd returns a copy of cmd prefixed with the command rendered from c.Wrapper. The rendered
+// command is split into arguments like --command. It returns cmd unchanged when there is no
+// wrapper.
+func (c *Benchdiff) wrapCmd(cmd *Command, data *WrapperData) (*Command, error) {
+	if c.Wrapper == "" {
+		return cmd, nil
+	}
+	tmpl, err := template.New("").Funcs(wrapperFuncs).Parse(c.Wrapper)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := splitCommandLine(buf.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return cmd, nil
+	}
+	args := make([]string, 0, len(fields)+len(cmd.Args))
+	args = append(args, fields[1:]...)
+	args = append(args, cmd.Path)
+	args = append(args, cmd.Args...)
+	wrapped := *cmd
+	wrapped.Path = fields[0]
+	wrapped.Args = args
+	return &wrapped, nil
+}
+
+// runWrapped runs cmd with c.Wrapper.
+func (c *Benchdiff) runWrapped(cmd *Command, data *WrapperData) (*CommandResult, error) {
+	wrapped, err := c.wrapCmd(cmd, data)
+	if err != nil {
+		return nil, err
+	}
+	return runCmd(c.runner(), wrapped, c.debug())
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchdiff_wrapCmd(t *testing.T) {
+	t.Run("no wrapper", func(t *testing.T) {
+		cmd := NewCommand("go", "test", ".")
+		got, err := new(Benchdiff).wrapCmd(cmd, &WrapperData{})
+		require.NoError(t, err)
+		require.Same(t, cmd, got)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		bd := &Benchdiff{
+			Wrapper: `nice -n {{ if eq .Side "warmup" }}10{{ else }}-5{{ end }} env WORKTREE={{ .Worktree }}`,
+		}
+		cmd := NewCommand("go", "test", ".")
+		cmd.Dir = "/tmp/worktree"
+		cmd.Env = []string{"FOO=bar"}
+		got, err := bd.wrapCmd(cmd, &WrapperData{
+			Side:     SideBase,
+			Ref:      "main",
+			Worktree: "/tmp/worktree",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "nice", got.Path)
+		require.Equal(t, []string{"-n", "-5", "env", "WORKTREE=/tmp/worktree", "go", "test", "."}, got.Args)
+		require.Equal(t, "/tmp/worktree", got.Dir)
+		require.Equal(t, []string{"FOO=bar"}, got.Env)
+	})
+
+	t.Run("quoted arguments", func(t *testing.T) {
+		bd := &Benchdiff{
+			Wrapper: `chrt -f 99 sh -c 'exec "$@"' sh env WORKTREE={{ quote .Worktree }}`,
+		}
+		got, err := bd.wrapCmd(NewCommand("go", "test", "."), &WrapperData{
+			Side:     SideHead,
+			Worktree: "/tmp/my 'work' tree",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "chrt", got.Path)
+		require.Equal(t, []string{
+			"-f", "99", "sh", "-c", `exec "$@"`, "sh",
+			"env", "WORKTREE=/tmp/my 'work' tree", "go", "test", ".",
+		}, got.Args)
+
+		bd.Wrapper = `sh -c 'unterminated`
+		_, err = bd.wrapCmd(NewCommand("go", "test", "."), &WrapperData{})
+		require.Error(t, err)
+	})
+}
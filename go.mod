@@ -8,6 +8,7 @@ require (
 	github.com/willabides/mdtable v0.3.1
 	golang.org/x/crypto v0.9.0
 	golang.org/x/perf v0.0.0-20201207232921-bdcc6220ee90
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -15,5 +16,4 @@ require (
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.8.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -19,6 +19,14 @@ type Benchstat struct {
 	// If zero, it defaults to 0.05.
 	Alpha float64
 
+	// Correction adjusts p-values for comparing many benchmarks at once. It is only applied
+	// by Compare. If empty, p-values aren't adjusted.
+	Correction Correction
+
+	// ConfidenceLevel, when set, makes Compare add a bootstrap confidence interval for the ratio
+	// of medians at this level, like 0.95, after the delta of each row.
+	ConfidenceLevel float64
+
 	// AddGeoMean specifies whether to add a line to the table
 	// showing the geometric mean of all the benchmark results.
 	AddGeoMean bool
@@ -28,7 +28,7 @@ func TestBenchstat_Run(t *testing.T) {
 			result, err = td.benchStat.Run(td.base, td.head)
 			require.NoError(t, err)
 			var buf bytes.Buffer
-			err = td.benchStat.OutputTables(&buf, result.Tables())
+			err = td.benchStat.OutputTables(&buf, td.benchStat.Compare(result).Tables)
 			require.NoError(t, err)
 			var want []byte
 			want, err = os.ReadFile(goldenFile(td))
@@ -168,6 +168,50 @@ var goldenTests = []*goldenTest{
 			DeltaTest: benchstat.TTest,
 		},
 	},
+	{
+		name: "oldnewholm.txt",
+		base: "old.txt",
+		head: "new.txt",
+		benchStat: &Benchstat{
+			Correction: Holm,
+		},
+	},
+	{
+		name: "oldnewbh.txt",
+		base: "old.txt",
+		head: "new.txt",
+		benchStat: &Benchstat{
+			Correction: BenjaminiHochberg,
+			Order:      benchstat.ByDelta,
+			AddGeoMean: true,
+		},
+	},
+	{
+		name: "oldnewpermutation.txt",
+		base: "old.txt",
+		head: "new.txt",
+		benchStat: &Benchstat{
+			DeltaTest: PermutationTest,
+		},
+	},
+	{
+		name: "oldnewci.txt",
+		base: "old.txt",
+		head: "new.txt",
+		benchStat: &Benchstat{
+			ConfidenceLevel: 0.95,
+		},
+	},
+	{
+		name: "oldnewci.md",
+		base: "old.txt",
+		head: "new.txt",
+		benchStat: &Benchstat{
+			ConfidenceLevel: 0.95,
+			Correction:      Holm,
+			OutputFormatter: MarkdownFormatter(nil),
+		},
+	},
 	{
 		name: "packages.txt",
 		base: "packagesold.txt",
@@ -235,6 +279,29 @@ var goldenTests = []*goldenTest{
 	},
 }
 
+func TestBenchstat_Compare_rowPValues(t *testing.T) {
+	for _, correction := range []Correction{NoCorrection, Holm} {
+		b := &Benchstat{Correction: correction}
+		collection, err := b.Run(filepath.Join("testdata", "old.txt"), filepath.Join("testdata", "new.txt"))
+		require.NoError(t, err)
+		comparison := b.Compare(collection)
+		require.NotEmpty(t, comparison.RowPValues)
+		for _, table := range comparison.Tables {
+			for _, row := range table.Rows {
+				p, ok := comparison.RowPValues[row]
+				if !ok {
+					continue
+				}
+				// the note has the same p-value rounded
+				require.Contains(t, row.Note, fmt.Sprintf("(p=%0.3f ", p), row.Benchmark)
+			}
+		}
+		for _, pv := range comparison.PValues {
+			require.Equal(t, pv.Adjusted, comparison.RowPValues[pv.Row])
+		}
+	}
+}
+
 func TestMain(m *testing.M) {
 	var err error
 	var writeGolden bool
@@ -281,7 +348,7 @@ func updateGolden() (err error) {
 			return err
 		}
 		var buf bytes.Buffer
-		err = td.benchStat.OutputTables(&buf, result.Tables())
+		err = td.benchStat.OutputTables(&buf, td.benchStat.Compare(result).Tables)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,76 @@
+package benchstatter
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// bootstrapResamples is how many times both sides are resampled for a confidence interval
+const bootstrapResamples = 1000
+
+// ConfidenceInterval is a bootstrap confidence interval for the percent change of the median from
+// old to new
+type ConfidenceInterval struct {
+	Level float64 `json:"level"`    // like 0.95
+	Low   float64 `json:"low_pct"`  // percent change at the low end of the interval
+	High  float64 `json:"high_pct"` // percent change at the high end of the interval
+}
+
+func (ci ConfidenceInterval) String() string {
+	return fmt.Sprintf("[%+.2f%%, %+.2f%%]", ci.Low, ci.High)
+}
+
+// bootstrapMedianRatio returns the percentile bootstrap confidence interval at level for the ratio of
+// the median of newValues to the median of oldValues. It returns false when there aren't enough values
+// or the old median can be 0.
+func bootstrapMedianRatio(rng *rand.Rand, oldValues, newValues []float64, level float64) (ConfidenceInterval, bool) {
+	if len(oldValues) < 2 || len(newValues) < 2 || level <= 0 || level >= 1 {
+		return ConfidenceInterval{}, false
+	}
+	oldSample := make([]float64, len(oldValues))
+	newSample := make([]float64, len(newValues))
+	ratios := make([]float64, 0, bootstrapResamples)
+	for i := 0; i < bootstrapResamples; i++ {
+		for j := range oldSample {
+			oldSample[j] = oldValues[rng.Intn(len(oldValues))]
+		}
+		for j := range newSample {
+			newSample[j] = newValues[rng.Intn(len(newValues))]
+		}
+		oldMedian := median(oldSample)
+		if oldMedian == 0 {
+			return ConfidenceInterval{}, false
+		}
+		ratios = append(ratios, median(newSample)/oldMedian)
+	}
+	sort.Float64s(ratios)
+	tail := (1 - level) / 2
+	return ConfidenceInterval{
+		Level: level,
+		Low:   (quantile(ratios, tail) - 1) * 100,
+		High:  (quantile(ratios, 1-tail) - 1) * 100,
+	}, true
+}
+
+// median returns the median of values. It sorts values.
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// quantile returns the q quantile of sorted by linear interpolation
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(math.Floor(pos))
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(i)
+	return sorted[i] + frac*(sorted[i+1]-sorted[i])
+}
@@ -0,0 +1,120 @@
+package benchstatter
+
+import (
+	"math/rand"
+
+	"golang.org/x/perf/benchstat"
+)
+
+// Comparison is the result of Benchstat.Compare
+type Comparison struct {
+	Tables []*benchstat.Table
+
+	// PValues are the p-values of every tested row. They are only set when there is a Correction.
+	PValues []PValue
+
+	// RowPValues are the p-values of every tested row after any correction. Unlike the p-values
+	// in the rows' notes, they aren't rounded.
+	RowPValues map[*benchstat.Row]float64
+
+	// ConfidenceIntervals are the bootstrap confidence intervals of the rows comparing two results.
+	// They are only set when there is a ConfidenceLevel.
+	ConfidenceIntervals map[*benchstat.Row]ConfidenceInterval
+}
+
+// PValue is the p-value of a row's delta test before and after correction
+type PValue struct {
+	Table    *benchstat.Table
+	Row      *benchstat.Row
+	P        float64
+	Adjusted float64
+}
+
+// Compare returns the tables comparing the benchmarks in c.
+//
+// When b.Correction is set, the p-value of every row in every table is adjusted for the number of
+// rows before rows are marked as changed, and the notes show the adjusted p-values.
+//
+// When b.ConfidenceLevel is set, the delta of each row is followed by the bootstrap confidence
+// interval for the ratio of medians like "+5.01% [+2.10%, +7.90%]".
+func (b *Benchstat) Compare(c *benchstat.Collection) *Comparison {
+	deltaTest := c.DeltaTest
+	if deltaTest == nil {
+		deltaTest = benchstat.UTest
+	}
+	// benchstat doesn't keep p-values, so record them by the old side of each row
+	tested := map[*benchstat.Metrics]float64{}
+	c.DeltaTest = func(old, new *benchstat.Metrics) (float64, error) {
+		p, err := deltaTest(old, new)
+		if err == nil && p != -1 {
+			tested[old] = p
+		}
+		return p, err
+	}
+	comparison := &Comparison{
+		Tables:     c.Tables(),
+		RowPValues: map[*benchstat.Row]float64{},
+	}
+	c.DeltaTest = deltaTest
+
+	for _, table := range comparison.Tables {
+		for _, row := range table.Rows {
+			if len(row.Metrics) != 2 {
+				continue
+			}
+			if p, ok := tested[row.Metrics[0]]; ok {
+				comparison.RowPValues[row] = p
+			}
+		}
+	}
+
+	if b.Correction != NoCorrection {
+		var raw []float64
+		for _, table := range comparison.Tables {
+			for _, row := range table.Rows {
+				p, ok := comparison.RowPValues[row]
+				if !ok {
+					continue
+				}
+				comparison.PValues = append(comparison.PValues, PValue{Table: table, Row: row, P: p})
+				raw = append(raw, p)
+			}
+		}
+		alpha := c.Alpha
+		if alpha == 0 {
+			alpha = 0.05
+		}
+		for i, adjusted := range b.Correction.Adjust(raw) {
+			pv := &comparison.PValues[i]
+			pv.Adjusted = adjusted
+			comparison.RowPValues[pv.Row] = adjusted
+			classifyRow(pv.Table.Metric, pv.Row, adjusted, alpha)
+		}
+	}
+
+	if b.ConfidenceLevel != 0 {
+		// a fixed seed keeps the intervals the same for the same results
+		rng := rand.New(rand.NewSource(1))
+		comparison.ConfidenceIntervals = map[*benchstat.Row]ConfidenceInterval{}
+		for _, table := range comparison.Tables {
+			for _, row := range table.Rows {
+				if len(row.Metrics) != 2 {
+					continue
+				}
+				ci, ok := bootstrapMedianRatio(rng, row.Metrics[0].RValues, row.Metrics[1].RValues, b.ConfidenceLevel)
+				if !ok {
+					continue
+				}
+				comparison.ConfidenceIntervals[row] = ci
+				row.Delta += " " + ci.String()
+			}
+		}
+	}
+
+	if c.Order != nil {
+		for _, table := range comparison.Tables {
+			sortTable(table, c.Order)
+		}
+	}
+	return comparison
+}
@@ -0,0 +1,106 @@
+package benchstatter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"golang.org/x/perf/benchstat"
+)
+
+// Correction is a method of correcting p-values for multiple comparisons
+type Correction string
+
+// Correction values
+const (
+	NoCorrection      Correction = ""
+	Bonferroni        Correction = "bonferroni" // controls the family-wise error rate
+	Holm              Correction = "holm"       // controls the family-wise error rate with more power than Bonferroni
+	BenjaminiHochberg Correction = "bh"         // controls the false discovery rate
+)
+
+// ParseCorrection returns the Correction named s. "none" and "" are NoCorrection.
+func ParseCorrection(s string) (Correction, error) {
+	switch Correction(s) {
+	case NoCorrection, "none":
+		return NoCorrection, nil
+	case Bonferroni, Holm, BenjaminiHochberg:
+		return Correction(s), nil
+	}
+	return "", fmt.Errorf("unknown correction %q", s)
+}
+
+// Adjust returns p-values adjusted for comparing len(pValues) hypotheses at once
+func (c Correction) Adjust(pValues []float64) []float64 {
+	m := float64(len(pValues))
+	adjusted := make([]float64, len(pValues))
+	// order is the indexes of pValues from smallest to largest p-value
+	order := make([]int, len(pValues))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return pValues[order[i]] < pValues[order[j]]
+	})
+	switch c {
+	case Bonferroni:
+		for i, p := range pValues {
+			adjusted[i] = math.Min(1, p*m)
+		}
+	case Holm:
+		// step down, keeping adjusted p-values from decreasing
+		prev := 0.0
+		for rank, i := range order {
+			prev = math.Max(prev, math.Min(1, (m-float64(rank))*pValues[i]))
+			adjusted[i] = prev
+		}
+	case BenjaminiHochberg:
+		// step up, keeping adjusted p-values from increasing
+		prev := 1.0
+		for rank := len(order) - 1; rank >= 0; rank-- {
+			i := order[rank]
+			prev = math.Min(prev, math.Min(1, m/float64(rank+1)*pValues[i]))
+			adjusted[i] = prev
+		}
+	default:
+		copy(adjusted, pValues)
+	}
+	return adjusted
+}
+
+// classifyRow sets the change, delta and note of row from its p-value the same way benchstat does
+func classifyRow(metric string, row *benchstat.Row, p, alpha float64) {
+	old, new := row.Metrics[0], row.Metrics[1]
+	row.PctDelta = 0
+	row.Delta = "~"
+	row.Change = 0
+	if p < alpha {
+		if new.Mean == old.Mean {
+			row.Delta = "0.00%"
+		} else {
+			pct := ((new.Mean / old.Mean) - 1.0) * 100.0
+			row.PctDelta = pct
+			row.Delta = fmt.Sprintf("%+.2f%%", pct)
+			if pct < 0 == (metric != "speed") { // smaller is better, except speeds
+				row.Change = +1
+			} else {
+				row.Change = -1
+			}
+		}
+	}
+	row.Note = fmt.Sprintf("(p=%0.3f n=%d+%d)", p, len(old.RValues), len(new.RValues))
+}
+
+// sortTable sorts the rows of table again after their deltas change. The geomean row stays last.
+func sortTable(table *benchstat.Table, order benchstat.Order) {
+	rows := table.Rows
+	var geomean *benchstat.Row
+	if n := len(rows); n > 0 && rows[n-1].Benchmark == "[Geo mean]" {
+		geomean = rows[n-1]
+		table.Rows = rows[:n-1]
+	}
+	benchstat.Sort(table, order)
+	if geomean != nil {
+		table.Rows = append(table.Rows, geomean)
+	}
+}
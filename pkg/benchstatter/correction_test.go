@@ -0,0 +1,38 @@
+package benchstatter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrection_Adjust(t *testing.T) {
+	pValues := []float64{0.04, 0.01, 0.03, 0.005}
+	for correction, want := range map[Correction][]float64{
+		NoCorrection:      {0.04, 0.01, 0.03, 0.005},
+		Bonferroni:        {0.16, 0.04, 0.12, 0.02},
+		Holm:              {0.06, 0.03, 0.06, 0.02},
+		BenjaminiHochberg: {0.04, 0.02, 0.04, 0.02},
+	} {
+		got := correction.Adjust(pValues)
+		require.InDeltaSlice(t, want, got, 1e-9, correction)
+	}
+	require.Equal(t, []float64{1, 0.2}, Bonferroni.Adjust([]float64{0.6, 0.1}))
+	require.Empty(t, Holm.Adjust(nil))
+}
+
+func TestParseCorrection(t *testing.T) {
+	for s, want := range map[string]Correction{
+		"":           NoCorrection,
+		"none":       NoCorrection,
+		"bonferroni": Bonferroni,
+		"holm":       Holm,
+		"bh":         BenjaminiHochberg,
+	} {
+		got, err := ParseCorrection(s)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	_, err := ParseCorrection("fdr")
+	require.EqualError(t, err, `unknown correction "fdr"`)
+}
@@ -0,0 +1,112 @@
+package benchstatter
+
+import (
+	"math"
+	"math/rand"
+
+	"golang.org/x/perf/benchstat"
+)
+
+// permutations is the most rearrangements PermutationTest tries. Samples with fewer possible
+// rearrangements are tested exactly.
+const permutations = 10000
+
+// PermutationTest is a DeltaTest using a two-sided permutation test on the difference of means. It
+// tries every way of splitting the combined values into groups the size of old and new when there
+// are at most 10000, and a random 10000 of them otherwise.
+func PermutationTest(old, new *benchstat.Metrics) (float64, error) {
+	xs, ys := old.RValues, new.RValues
+	if len(xs) < 2 || len(ys) < 2 {
+		return -1, benchstat.ErrSampleSize
+	}
+	values := append(append([]float64{}, xs...), ys...)
+	allEqual := true
+	total := 0.0
+	for _, v := range values {
+		total += v
+		allEqual = allEqual && v == values[0]
+	}
+	if allEqual {
+		return -1, benchstat.ErrSamplesEqual
+	}
+	n, k := len(values), len(xs)
+	// meanDiff returns the difference of means when the values in the first group sum to sum
+	meanDiff := func(sum float64) float64 {
+		return math.Abs((total-sum)/float64(n-k) - sum/float64(k))
+	}
+	observed := meanDiff(sum(xs))
+	// tolerate rounding in the sums of rearrangements with the same difference as observed
+	threshold := observed - 1e-9*math.Max(1, observed)
+
+	if count, ok := binomial(n, k, permutations); ok {
+		extreme := 0
+		forEachCombination(n, k, func(indexes []int) {
+			s := 0.0
+			for _, i := range indexes {
+				s += values[i]
+			}
+			if meanDiff(s) >= threshold {
+				extreme++
+			}
+		})
+		return float64(extreme) / float64(count), nil
+	}
+
+	// a fixed seed keeps the p-value the same for the same results
+	rng := rand.New(rand.NewSource(1))
+	extreme := 0
+	shuffled := append([]float64{}, values...)
+	for i := 0; i < permutations; i++ {
+		rng.Shuffle(len(shuffled), func(a, b int) {
+			shuffled[a], shuffled[b] = shuffled[b], shuffled[a]
+		})
+		if meanDiff(sum(shuffled[:k])) >= threshold {
+			extreme++
+		}
+	}
+	// count the observed split so the p-value is never 0
+	return float64(extreme+1) / float64(permutations+1), nil
+}
+
+func sum(values []float64) float64 {
+	s := 0.0
+	for _, v := range values {
+		s += v
+	}
+	return s
+}
+
+// binomial returns n choose k and true, or false when it is over limit
+func binomial(n, k, limit int) (int, bool) {
+	result := 1
+	for i := 1; i <= k; i++ {
+		result = result * (n - k + i) / i
+		if result > limit {
+			return 0, false
+		}
+	}
+	return result, true
+}
+
+// forEachCombination calls fn with every set of k indexes from 0 to n-1 in increasing order
+func forEachCombination(n, k int, fn func(indexes []int)) {
+	indexes := make([]int, k)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	for {
+		fn(indexes)
+		// advance the rightmost index that can move
+		i := k - 1
+		for i >= 0 && indexes[i] == n-k+i {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		indexes[i]++
+		for j := i + 1; j < k; j++ {
+			indexes[j] = indexes[j-1] + 1
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package benchstatter
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/perf/benchstat"
+)
+
+func TestPermutationTest(t *testing.T) {
+	// only splitting 1,2,3 from 4,5,6 is as extreme as the observed split in either direction
+	p, err := PermutationTest(
+		&benchstat.Metrics{RValues: []float64{1, 2, 3}},
+		&benchstat.Metrics{RValues: []float64{4, 5, 6}},
+	)
+	require.NoError(t, err)
+	require.InDelta(t, 2.0/20, p, 1e-9)
+
+	p, err = PermutationTest(
+		&benchstat.Metrics{RValues: []float64{1, 4, 2, 3}},
+		&benchstat.Metrics{RValues: []float64{3, 2, 4, 1}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, 1.0, p)
+
+	// too many splits to try them all
+	old := &benchstat.Metrics{RValues: []float64{100, 101, 99, 100, 102, 98, 100, 101, 99, 100}}
+	new := &benchstat.Metrics{RValues: []float64{110, 111, 109, 110, 112, 108, 110, 111, 109, 110}}
+	p, err = PermutationTest(old, new)
+	require.NoError(t, err)
+	require.InDelta(t, 1.0/10001, p, 1e-9)
+
+	_, err = PermutationTest(&benchstat.Metrics{RValues: []float64{1}}, new)
+	require.Equal(t, benchstat.ErrSampleSize, err)
+	_, err = PermutationTest(&benchstat.Metrics{RValues: []float64{1, 1}}, &benchstat.Metrics{RValues: []float64{1, 1}})
+	require.Equal(t, benchstat.ErrSamplesEqual, err)
+}
+
+func Test_binomial(t *testing.T) {
+	n, ok := binomial(6, 3, 100)
+	require.True(t, ok)
+	require.Equal(t, 20, n)
+	_, ok = binomial(20, 10, 10000)
+	require.False(t, ok)
+}
+
+func Test_bootstrapMedianRatio(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ci, ok := bootstrapMedianRatio(rng, []float64{100, 100, 100}, []float64{110, 110}, 0.95)
+	require.True(t, ok)
+	require.Equal(t, 0.95, ci.Level)
+	require.InDelta(t, 10, ci.Low, 1e-9)
+	require.InDelta(t, 10, ci.High, 1e-9)
+	require.Equal(t, "[+10.00%, +10.00%]", ci.String())
+
+	ci, ok = bootstrapMedianRatio(rng, []float64{100, 101, 99, 100, 102}, []float64{90, 91, 89, 90, 92}, 0.9)
+	require.True(t, ok)
+	require.Less(t, ci.Low, ci.High)
+	require.Less(t, ci.High, 0.0)
+	require.Greater(t, ci.Low, -20.0)
+
+	_, ok = bootstrapMedianRatio(rng, []float64{100}, []float64{110, 110}, 0.95)
+	require.False(t, ok)
+	_, ok = bootstrapMedianRatio(rng, []float64{0, 0}, []float64{110, 110}, 0.95)
+	require.False(t, ok)
+}